@@ -2,34 +2,70 @@ package api
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/lesnoi-kot/versions-backend/metrics"
 	"github.com/lesnoi-kot/versions-backend/mongostore"
 	"github.com/lesnoi-kot/versions-backend/mq"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
 )
 
 const (
 	SHUTDOWN_TIMEOUT = 10_000
+
+	// Pace of GitHub REST calls made by background tasks.
+	githubBackgroundRate  = rate.Limit(1)
+	githubBackgroundBurst = 5
 )
 
 type APIConfig struct {
 	Store        *mongostore.Store
-	MQ           *mq.AMQPConnection
+	MQ           mq.Queue
 	AllowOrigins []string
 	Debug        bool
+	GithubToken  string
 }
 
 type APIService struct {
 	APIConfig
-	handler *echo.Echo
+	handler    *echo.Echo
+	grpcServer *grpc.Server
+
+	// Background tasks are bound to the service lifetime, not to requests.
+	tasksCtx      context.Context
+	cancelTasks   context.CancelFunc
+	tasks         *sync.WaitGroup
+	githubLimiter *rate.Limiter
+	outboxWake    chan struct{}
+
+	// githubURL replaces the GitHub REST API URL in tests.
+	githubURL *url.URL
 }
 
-func NewAPI(config APIConfig) *APIService {
+func NewAPI(config APIConfig) (*APIService, error) {
+	_, specRouter, err := loadOpenAPISpec()
+	if err != nil {
+		return nil, err
+	}
+
+	tasksCtx, cancelTasks := context.WithCancel(context.Background())
+
 	api := &APIService{
-		APIConfig: config,
-		handler:   echo.New(),
+		APIConfig:     config,
+		handler:       echo.New(),
+		tasksCtx:      tasksCtx,
+		cancelTasks:   cancelTasks,
+		tasks:         new(sync.WaitGroup),
+		githubLimiter: rate.NewLimiter(githubBackgroundRate, githubBackgroundBurst),
+		outboxWake:    make(chan struct{}, 1),
 	}
 
 	api.handler.Debug = config.Debug
@@ -47,10 +83,13 @@ func NewAPI(config APIConfig) *APIService {
 
 	api.handler.Pre(middleware.RemoveTrailingSlash())
 	api.handler.Use(
+		otelecho.Middleware(tracedServiceName, otelecho.WithSkipper(skipTracing)),
+		observeRequests,
 		middleware.Logger(),
 		middleware.SecureWithConfig(securityConfig),
 		middleware.CORSWithConfig(corsConfig),
 		middleware.BodyLimit("1M"),
+		validateRequests(specRouter),
 	)
 
 	if !config.Debug {
@@ -58,19 +97,43 @@ func NewAPI(config APIConfig) *APIService {
 	}
 
 	initRoutes(api)
-	return api
+	api.grpcServer = newGRPCServer(api)
+	return api, nil
 }
 
 func initRoutes(api *APIService) {
 	root := api.handler.Group("")
+	root.GET("/events", api.getEvents)
+	root.POST("/graphql", newGraphQLHandler(api))
+	root.GET("/openapi.json", getOpenAPISpec)
+	root.GET("/health", api.getHealth)
+	root.GET("/metrics", echo.WrapHandler(metrics.Handler()))
 
 	sources := root.Group("/sources")
 	sources.GET("", api.getSources)
+	sources.GET("/releases.ics", api.getSourcesCalendar)
+	sources.POST("/import", api.importSources, api.idempotent)
+	sources.GET("/import/:id", api.getImport)
 	sources.GET("/:id", api.getSource)
-	sources.POST("", api.addSource)
+	sources.GET("/:id/releases.ics", api.getSourceCalendar)
+	sources.GET("/:id/events", api.getSourceEvents)
+	sources.POST("", api.addSource, api.idempotent)
+	sources.DELETE("/:id", api.deleteSource, api.idempotent)
+	sources.POST("/:id/restore", api.restoreSource, api.idempotent)
+	sources.POST("/:id/refresh", api.refreshSource, api.idempotent)
+	sources.GET("/:id/jobs", api.getSourceJobs)
+
+	root.GET("/jobs/:id", api.getJob)
+
+	// Reports start tracking missing sources.
+	root.POST("/reports/outdated", api.createOutdatedReport, api.idempotent)
 }
 
 func (api *APIService) errorHandler(err error, c echo.Context) {
+	if errors.Is(err, mq.ErrDisconnected) {
+		err = echo.NewHTTPError(http.StatusServiceUnavailable, "message queue is unavailable")
+	}
+
 	api.handler.DefaultHTTPErrorHandler(err, c)
 }
 
@@ -85,5 +148,34 @@ func (a APIService) Shutdown() error {
 	)
 
 	defer cancel()
-	return a.handler.Shutdown(ctx)
+
+	// Streaming calls never finish by themselves, so the graceful stop is cut
+	// short by the shutdown timeout.
+	grpcStopped := make(chan struct{})
+	go func() {
+		a.grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+
+	err := a.handler.Shutdown(ctx)
+
+	select {
+	case <-grpcStopped:
+	case <-ctx.Done():
+		a.grpcServer.Stop()
+	}
+
+	a.cancelTasks()
+	a.tasks.Wait()
+
+	return err
+}
+
+// runTask runs fn in background until the service is shut down.
+func (api *APIService) runTask(fn func(ctx context.Context)) {
+	api.tasks.Add(1)
+	go func() {
+		defer api.tasks.Done()
+		fn(api.tasksCtx)
+	}()
 }
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lesnoi-kot/versions-backend/common"
+	"github.com/lesnoi-kot/versions-backend/mongostore"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const maxCalendarSources = 50
+
+var calendarProjection = bson.D{
+	{"_id", true},
+	{"owner", true},
+	{"name", true},
+	{"releases", true},
+}
+
+func (api *APIService) getSourceCalendar(c echo.Context) error {
+	sourceID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	source, err := api.Store.GetSourceBy(
+		c.Request().Context(),
+		bson.D{{"_id", sourceID}, {"deleted_at", nil}},
+		options.FindOne().SetProjection(calendarProjection),
+	)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return echo.ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	return writeCalendar(c, sourceFullName(source), []*mongostore.Source{source})
+}
+
+// getSourcesCalendar merges releases of several sources passed as repeated
+// "id" query params into one calendar.
+func (api *APIService) getSourcesCalendar(c echo.Context) error {
+	ids := c.QueryParams()["id"]
+	if len(ids) == 0 || len(ids) > maxCalendarSources {
+		return echo.ErrBadRequest
+	}
+
+	sourceIDs := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		sourceID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return echo.ErrBadRequest
+		}
+		sourceIDs = append(sourceIDs, sourceID)
+	}
+
+	sources, err := mongostore.GetDocuments(
+		c.Request().Context(),
+		api.Store,
+		mongostore.GetDocumentsOptions[mongostore.Source]{
+			Collection: mongostore.SourcesCollectionName,
+			Filter:     bson.D{{"_id", bson.D{{"$in", sourceIDs}}}, {"deleted_at", nil}},
+			FindOptions: options.
+				Find().
+				SetProjection(calendarProjection).
+				SetMaxTime(5 * time.Second),
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	return writeCalendar(c, "Releases", sources)
+}
+
+func writeCalendar(c echo.Context, name string, sources []*mongostore.Source) error {
+	cal := &common.ICalendar{Name: name}
+
+	for _, source := range sources {
+		for _, release := range source.Releases {
+			cal.Events = append(cal.Events, common.ICalEvent{
+				UID:         fmt.Sprintf("%s@versions", release.ID),
+				Summary:     fmt.Sprintf("%s %s", sourceFullName(source), release.TagName),
+				Description: release.Name,
+				URL:         release.URL,
+				Date:        release.PublishedAt,
+				Stamp:       release.PublishedAt,
+			})
+		}
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/calendar; charset=utf-8")
+	res.Header().Set(echo.HeaderContentDisposition, `inline; filename="releases.ics"`)
+	res.WriteHeader(http.StatusOK)
+
+	_, err := cal.WriteTo(res)
+	return err
+}
+
+func sourceFullName(source *mongostore.Source) string {
+	return strings.Trim(source.Owner+"/"+source.Name, "/")
+}
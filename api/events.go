@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lesnoi-kot/versions-backend/mongostore"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const eventsKeepAliveInterval = 15 * time.Second
+
+func (api *APIService) getEvents(c echo.Context) error {
+	return api.streamEvents(c)
+}
+
+func (api *APIService) getSourceEvents(c echo.Context) error {
+	sourceID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	_, err = api.Store.GetSourceBy(
+		c.Request().Context(),
+		bson.D{{"_id", sourceID}, {"deleted_at", nil}},
+		options.FindOne().SetProjection(bson.D{{"_id", true}}),
+	)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return echo.ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	return api.streamEvents(c, sourceID)
+}
+
+// streamEvents pushes source events to the client as Server-Sent Events.
+// Events missed since Last-Event-ID are replayed before the live ones.
+func (api *APIService) streamEvents(c echo.Context, sourceIDs ...primitive.ObjectID) error {
+	ctx := c.Request().Context()
+
+	stream, err := api.Store.WatchSourceEvents(ctx, nil, sourceIDs...)
+	if err != nil {
+		return err
+	}
+
+	// Subscribe before the replay so nothing slips in between, replayed events
+	// are skipped when they show up in the stream.
+	events := make(chan *mongostore.SourceEvent)
+	go func() {
+		defer close(events)
+		defer stream.Close(context.Background())
+
+		for stream.Next(ctx) {
+			change := new(mongostore.SourceEventChange)
+			if err := stream.Decode(change); err != nil {
+				c.Logger().Errorf("Source event decoding error: %s", err)
+				continue
+			}
+
+			select {
+			case events <- &change.FullDocument:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	replayed := make(map[primitive.ObjectID]bool)
+	if lastEventID, err := primitive.ObjectIDFromHex(c.Request().Header.Get("Last-Event-ID")); err == nil {
+		missed, err := api.Store.GetSourceEventsAfter(ctx, lastEventID, sourceIDs...)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range missed {
+			if err := writeServerSentEvent(res, event); err != nil {
+				return nil
+			}
+			replayed[event.ID] = true
+		}
+	}
+
+	keepAlive := time.NewTicker(eventsKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(res, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if replayed[event.ID] {
+				continue
+			}
+			if err := writeServerSentEvent(res, event); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+func writeServerSentEvent(res *echo.Response, event *mongostore.SourceEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(res, "id: %s\nevent: %s\ndata: %s\n\n", event.ID.Hex(), event.Type, data)
+	if err != nil {
+		return err
+	}
+
+	res.Flush()
+	return nil
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	_ "embed"
+	"time"
+
+	"github.com/graph-gophers/dataloader/v7"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+	"github.com/labstack/echo/v4"
+	"github.com/lesnoi-kot/versions-backend/mongostore"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	graphqlMaxDepth     = 8
+	graphqlBatchWait    = 2 * time.Millisecond
+	graphqlMaxPageItems = 100
+)
+
+//go:embed schema.graphql
+var graphqlSchema string
+
+func newGraphQLHandler(api *APIService) echo.HandlerFunc {
+	schema := graphql.MustParseSchema(
+		graphqlSchema,
+		&graphqlResolver{api: api},
+		graphql.MaxDepth(graphqlMaxDepth),
+	)
+	handler := &relay.Handler{Schema: schema}
+
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := context.WithValue(req.Context(), graphqlLoadersKey{}, newGraphQLLoaders(api.Store))
+
+		handler.ServeHTTP(c.Response(), req.WithContext(ctx))
+		return nil
+	}
+}
+
+type graphqlLoadersKey struct{}
+
+// graphqlLoaders batch lookups made by resolvers of a single request, so
+// nested fields of a list cost one query instead of one per item.
+type graphqlLoaders struct {
+	sources *dataloader.Loader[primitive.ObjectID, *mongostore.Source]
+}
+
+func newGraphQLLoaders(store *mongostore.Store) *graphqlLoaders {
+	return &graphqlLoaders{
+		sources: dataloader.NewBatchedLoader(
+			func(ctx context.Context, ids []primitive.ObjectID) []*dataloader.Result[*mongostore.Source] {
+				results := make([]*dataloader.Result[*mongostore.Source], len(ids))
+
+				sources, err := store.GetSourcesByIDs(ctx, ids)
+				if err != nil {
+					for i := range results {
+						results[i] = &dataloader.Result[*mongostore.Source]{Error: err}
+					}
+					return results
+				}
+
+				sourcesByID := make(map[primitive.ObjectID]*mongostore.Source, len(sources))
+				for _, source := range sources {
+					sourcesByID[source.ID] = source
+				}
+
+				for i, id := range ids {
+					results[i] = &dataloader.Result[*mongostore.Source]{Data: sourcesByID[id]}
+				}
+
+				return results
+			},
+			dataloader.WithWait[primitive.ObjectID, *mongostore.Source](graphqlBatchWait),
+			dataloader.WithBatchCapacity[primitive.ObjectID, *mongostore.Source](graphqlMaxPageItems),
+		),
+	}
+}
+
+func loadSource(ctx context.Context, id primitive.ObjectID) (*mongostore.Source, error) {
+	loaders := ctx.Value(graphqlLoadersKey{}).(*graphqlLoaders)
+	return loaders.sources.Load(ctx, id)()
+}
+
+func loadSources(ctx context.Context, ids []primitive.ObjectID) ([]*mongostore.Source, error) {
+	loaders := ctx.Value(graphqlLoadersKey{}).(*graphqlLoaders)
+
+	sources, errs := loaders.sources.LoadMany(ctx, ids)()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sources, nil
+}
@@ -0,0 +1,375 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/graph-gophers/graphql-go"
+	"github.com/lesnoi-kot/versions-backend/mongostore"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+type graphqlResolver struct {
+	api *APIService
+}
+
+func (r *graphqlResolver) Sources(ctx context.Context, args struct {
+	Name  *string
+	Page  int32
+	Count int32
+}) (*sourcePageResolver, error) {
+	q := mongostore.SourcesQuery{
+		Page:  int(args.Page),
+		Count: int(args.Count),
+	}
+	if args.Name != nil {
+		q.Name = sanitizeNameFilter(*args.Name)
+	}
+	if q.Count <= 0 || q.Count > graphqlMaxPageItems {
+		q.Count = graphqlMaxPageItems
+	}
+
+	sources, totalCount, err := mongostore.FindSources[mongostore.Source](ctx, r.api.Store, q)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &sourcePageResolver{totalCount: int32(totalCount)}
+	for _, source := range sources {
+		page.data = append(page.data, &sourceResolver{source})
+	}
+
+	return page, nil
+}
+
+func (r *graphqlResolver) Source(ctx context.Context, args struct{ ID graphql.ID }) (*sourceResolver, error) {
+	sourceID, err := primitive.ObjectIDFromHex(string(args.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := loadSource(ctx, sourceID)
+	if err != nil || source == nil {
+		return nil, err
+	}
+
+	return &sourceResolver{source}, nil
+}
+
+func (r *graphqlResolver) Releases(ctx context.Context, args struct {
+	SourceIDs []graphql.ID
+	Filter    *releaseFilter
+	First     int32
+	After     *string
+}) (*releaseConnectionResolver, error) {
+	if len(args.SourceIDs) > graphqlMaxPageItems {
+		return nil, errors.New("too many sources requested")
+	}
+
+	sourceIDs := make([]primitive.ObjectID, 0, len(args.SourceIDs))
+	for _, id := range args.SourceIDs {
+		sourceID, err := primitive.ObjectIDFromHex(string(id))
+		if err != nil {
+			return nil, err
+		}
+		sourceIDs = append(sourceIDs, sourceID)
+	}
+
+	sources, err := loadSources(ctx, sourceIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	releases := []*releaseResolver{}
+	for _, source := range sources {
+		if source != nil {
+			releases = append(releases, sourceReleases(source)...)
+		}
+	}
+
+	sort.SliceStable(releases, func(i, j int) bool {
+		return releases[i].release.PublishedAt.After(releases[j].release.PublishedAt)
+	})
+
+	return newReleaseConnection(releases, releasesArgs{
+		Filter: args.Filter,
+		First:  args.First,
+		After:  args.After,
+	})
+}
+
+type sourcePageResolver struct {
+	totalCount int32
+	data       []*sourceResolver
+}
+
+func (r *sourcePageResolver) TotalCount() int32 {
+	return r.totalCount
+}
+
+func (r *sourcePageResolver) Data() []*sourceResolver {
+	return r.data
+}
+
+type sourceResolver struct {
+	source *mongostore.Source
+}
+
+func (r *sourceResolver) ID() graphql.ID {
+	return graphql.ID(r.source.ID.Hex())
+}
+
+func (r *sourceResolver) Owner() string {
+	return r.source.Owner
+}
+
+func (r *sourceResolver) Name() string {
+	return r.source.Name
+}
+
+func (r *sourceResolver) Description() string {
+	return r.source.Description
+}
+
+func (r *sourceResolver) URL() string {
+	return r.source.URL
+}
+
+func (r *sourceResolver) IsFetching() bool {
+	return r.source.IsFetching
+}
+
+func (r *sourceResolver) CreatedAt() *graphql.Time {
+	if r.source.CreatedAt.IsZero() {
+		return nil
+	}
+	return &graphql.Time{Time: r.source.CreatedAt}
+}
+
+func (r *sourceResolver) UpdatedAt() *graphql.Time {
+	if r.source.UpdatedAt.IsZero() {
+		return nil
+	}
+	return &graphql.Time{Time: r.source.UpdatedAt}
+}
+
+func (r *sourceResolver) LatestRelease(ctx context.Context) (*releaseResolver, error) {
+	releases, err := r.releases(ctx)
+	if err != nil || len(releases) == 0 {
+		return nil, err
+	}
+
+	return releases[0], nil
+}
+
+func (r *sourceResolver) Releases(ctx context.Context, args releasesArgs) (*releaseConnectionResolver, error) {
+	releases, err := r.releases(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return newReleaseConnection(releases, args)
+}
+
+// releases returns releases of the source newest first. Sources listed by the
+// sources query come without releases, so they are loaded in a batch.
+func (r *sourceResolver) releases(ctx context.Context) ([]*releaseResolver, error) {
+	source := r.source
+
+	if source.Releases == nil && !source.IsFetching {
+		loaded, err := loadSource(ctx, source.ID)
+		if err != nil || loaded == nil {
+			return nil, err
+		}
+		source = loaded
+	}
+
+	return sourceReleases(source), nil
+}
+
+func sourceReleases(source *mongostore.Source) []*releaseResolver {
+	releases := make([]*releaseResolver, 0, len(source.Releases))
+	for i := len(source.Releases) - 1; i >= 0; i-- {
+		releases = append(releases, &releaseResolver{
+			sourceID: source.ID,
+			release:  &source.Releases[i],
+		})
+	}
+
+	return releases
+}
+
+type releaseResolver struct {
+	sourceID primitive.ObjectID
+	release  *mongostore.Release
+}
+
+func (r *releaseResolver) ID() graphql.ID {
+	return graphql.ID(r.release.ID)
+}
+
+func (r *releaseResolver) SourceID() graphql.ID {
+	return graphql.ID(r.sourceID.Hex())
+}
+
+func (r *releaseResolver) Name() string {
+	return r.release.Name
+}
+
+func (r *releaseResolver) TagName() string {
+	return r.release.TagName
+}
+
+func (r *releaseResolver) URL() string {
+	return r.release.URL
+}
+
+func (r *releaseResolver) PublishedAt() graphql.Time {
+	return graphql.Time{Time: r.release.PublishedAt}
+}
+
+func (r *releaseResolver) IsSemver() bool {
+	return r.release.IsSemver
+}
+
+func (r *releaseResolver) Major() int32 {
+	return int32(r.release.Major)
+}
+
+func (r *releaseResolver) Minor() int32 {
+	return int32(r.release.Minor)
+}
+
+func (r *releaseResolver) Patch() int32 {
+	return int32(r.release.Patch)
+}
+
+func (r *releaseResolver) IsPrerelease() bool {
+	return r.release.IsPrerelease
+}
+
+type releaseFilter struct {
+	SemverOnly      *bool
+	Major           *int32
+	Minor           *int32
+	TagPrefix       *string
+	PublishedAfter  *graphql.Time
+	PublishedBefore *graphql.Time
+}
+
+func (f *releaseFilter) match(release *mongostore.Release) bool {
+	if f == nil {
+		return true
+	}
+
+	switch {
+	case f.SemverOnly != nil && *f.SemverOnly && !release.IsSemver:
+		return false
+	case f.Major != nil && (!release.IsSemver || release.Major != uint64(*f.Major)):
+		return false
+	case f.Minor != nil && (!release.IsSemver || release.Minor != uint64(*f.Minor)):
+		return false
+	case f.TagPrefix != nil && !strings.HasPrefix(release.TagName, *f.TagPrefix):
+		return false
+	case f.PublishedAfter != nil && !release.PublishedAt.After(f.PublishedAfter.Time):
+		return false
+	case f.PublishedBefore != nil && !release.PublishedAt.Before(f.PublishedBefore.Time):
+		return false
+	}
+
+	return true
+}
+
+type releasesArgs struct {
+	Filter *releaseFilter
+	First  int32
+	After  *string
+}
+
+type releaseConnectionResolver struct {
+	totalCount  int32
+	nodes       []*releaseResolver
+	hasNextPage bool
+}
+
+// newReleaseConnection filters the releases and cuts a page after the
+// release pointed by the cursor.
+func newReleaseConnection(releases []*releaseResolver, args releasesArgs) (*releaseConnectionResolver, error) {
+	filtered := make([]*releaseResolver, 0, len(releases))
+	for _, release := range releases {
+		if args.Filter.match(release.release) {
+			filtered = append(filtered, release)
+		}
+	}
+
+	start := 0
+	if args.After != nil {
+		afterID, err := base64.RawURLEncoding.DecodeString(*args.After)
+		if err != nil {
+			return nil, errInvalidCursor
+		}
+
+		start = -1
+		for i, release := range filtered {
+			if release.release.ID == string(afterID) {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			return nil, errInvalidCursor
+		}
+	}
+
+	first := int(args.First)
+	if first <= 0 || first > graphqlMaxPageItems {
+		first = graphqlMaxPageItems
+	}
+
+	end := start + first
+	if end > len(filtered) {
+		end = len(filtered)
+	}
+
+	return &releaseConnectionResolver{
+		totalCount:  int32(len(filtered)),
+		nodes:       filtered[start:end],
+		hasNextPage: end < len(filtered),
+	}, nil
+}
+
+func (r *releaseConnectionResolver) TotalCount() int32 {
+	return r.totalCount
+}
+
+func (r *releaseConnectionResolver) Nodes() []*releaseResolver {
+	return r.nodes
+}
+
+func (r *releaseConnectionResolver) PageInfo() *pageInfoResolver {
+	info := &pageInfoResolver{hasNextPage: r.hasNextPage}
+	if len(r.nodes) > 0 {
+		cursor := base64.RawURLEncoding.EncodeToString([]byte(r.nodes[len(r.nodes)-1].release.ID))
+		info.endCursor = &cursor
+	}
+
+	return info
+}
+
+type pageInfoResolver struct {
+	endCursor   *string
+	hasNextPage bool
+}
+
+func (r *pageInfoResolver) EndCursor() *string {
+	return r.endCursor
+}
+
+func (r *pageInfoResolver) HasNextPage() bool {
+	return r.hasNextPage
+}
@@ -0,0 +1,251 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lesnoi-kot/versions-backend/mongostore"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+type graphqlResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// queryGraphQL runs the query against the API backed by the mocked store.
+func queryGraphQL(mt *mtest.T, query string) *graphqlResponse {
+	api, err := NewAPI(APIConfig{Store: &mongostore.Store{Client: mt.Client}})
+	if err != nil {
+		mt.Fatalf("API setup error: %s", err)
+	}
+
+	body, err := json.Marshal(map[string]string{"query": query})
+	if err != nil {
+		mt.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	api.handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		mt.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	res := new(graphqlResponse)
+	if err := json.Unmarshal(rec.Body.Bytes(), res); err != nil {
+		mt.Fatalf("Invalid response %s: %s", rec.Body, err)
+	}
+
+	return res
+}
+
+func graphqlSource(id primitive.ObjectID, releases int) bson.D {
+	docs := bson.A{}
+	for i := 0; i < releases; i++ {
+		docs = append(docs, bson.D{
+			{"id", fmt.Sprintf("RE_%d", i)},
+			{"tag_name", fmt.Sprintf("v1.0.%d", i)},
+			{"published_at", time.Unix(int64(i), 0)},
+		})
+	}
+
+	return bson.D{
+		{"_id", id},
+		{"owner", "a"},
+		{"name", id.Hex()},
+		{"is_fetching", false},
+		{"releases", docs},
+	}
+}
+
+func graphqlSources(docs ...bson.D) bson.D {
+	return mtest.CreateCursorResponse(0, mongostore.DatabaseName+"."+mongostore.SourcesCollectionName, mtest.FirstBatch, docs...)
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	sourceID := primitive.NewObjectID()
+
+	tooManyIDs := make([]string, graphqlMaxPageItems+1)
+	for i := range tooManyIDs {
+		tooManyIDs[i] = fmt.Sprintf("%q", primitive.NewObjectID().Hex())
+	}
+
+	type testCase struct {
+		name      string
+		query     string
+		responses []bson.D
+		error     string
+	}
+
+	testCases := []testCase{
+		{
+			"deepest query of the schema",
+			`{ sources { data { releases { pageInfo { endCursor } } } } }`,
+			[]bson.D{
+				graphqlSources(bson.D{{"_id", sourceID}, {"is_fetching", false}}),
+				graphqlSources(bson.D{{"n", 1}}),
+				graphqlSources(graphqlSource(sourceID, 1)),
+			},
+			"",
+		},
+		{
+			"query deeper than the cap",
+			`{ __schema { types { fields { type { ofType { ofType { ofType { ofType { name } } } } } } } } }`,
+			nil,
+			"exceeds max depth",
+		},
+		{
+			"invalid source ID",
+			`{ source(id: "not-an-id") { name } }`,
+			nil,
+			"not a valid ObjectID",
+		},
+		{
+			"invalid release source ID",
+			`{ releases(sourceIds: ["not-an-id"]) { totalCount } }`,
+			nil,
+			"not a valid ObjectID",
+		},
+		{
+			"too many release sources",
+			`{ releases(sourceIds: [` + strings.Join(tooManyIDs, ", ") + `]) { totalCount } }`,
+			nil,
+			"too many sources",
+		},
+	}
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	for _, test := range testCases {
+		mt.Run(test.name, func(mt *mtest.T) {
+			mt.AddMockResponses(test.responses...)
+
+			res := queryGraphQL(mt, test.query)
+
+			if test.error == "" && len(res.Errors) > 0 {
+				mt.Fatalf("Unexpected errors: %v", res.Errors)
+			}
+			if test.error != "" && (len(res.Errors) == 0 || !strings.Contains(res.Errors[0].Message, test.error)) {
+				mt.Fatalf("Expected error %q, got %v", test.error, res.Errors)
+			}
+		})
+	}
+}
+
+func TestGraphQLPageCaps(t *testing.T) {
+	sourceID := primitive.NewObjectID()
+
+	type testCase struct {
+		name      string
+		query     string
+		responses []bson.D
+		limit     int32
+		nodes     int
+	}
+
+	testCases := []testCase{
+		{
+			"sources",
+			`{ sources(count: 1000) { totalCount } }`,
+			[]bson.D{graphqlSources(), graphqlSources(bson.D{{"n", 0}})},
+			graphqlMaxPageItems,
+			0,
+		},
+		{
+			"source releases",
+			fmt.Sprintf(`{ source(id: %q) { releases(first: 1000) { nodes { id } } } }`, sourceID.Hex()),
+			[]bson.D{graphqlSources(graphqlSource(sourceID, graphqlMaxPageItems+50))},
+			0,
+			graphqlMaxPageItems,
+		},
+		{
+			"releases",
+			fmt.Sprintf(`{ releases(sourceIds: [%q], first: 1000) { nodes { id } } }`, sourceID.Hex()),
+			[]bson.D{graphqlSources(graphqlSource(sourceID, graphqlMaxPageItems+50))},
+			0,
+			graphqlMaxPageItems,
+		},
+	}
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	for _, test := range testCases {
+		mt.Run(test.name, func(mt *mtest.T) {
+			mt.AddMockResponses(test.responses...)
+
+			res := queryGraphQL(mt, test.query)
+			if len(res.Errors) > 0 {
+				mt.Fatalf("Unexpected errors: %v", res.Errors)
+			}
+
+			if test.limit > 0 {
+				find := mt.GetStartedEvent()
+				if limit, _ := find.Command.Lookup("limit").AsInt64OK(); limit != int64(test.limit) {
+					mt.Errorf("Find limit did not match: %d != %d", limit, test.limit)
+				}
+			}
+
+			if test.nodes > 0 {
+				if nodes := strings.Count(string(res.Data), `"id"`); nodes != test.nodes {
+					mt.Errorf("Number of nodes did not match: %d != %d", nodes, test.nodes)
+				}
+			}
+		})
+	}
+}
+
+func TestGraphQLLoaderBatching(t *testing.T) {
+	first, second := primitive.NewObjectID(), primitive.NewObjectID()
+
+	type testCase struct {
+		name  string
+		query string
+	}
+
+	testCases := []testCase{
+		{
+			"aliased sources",
+			fmt.Sprintf(`{ a: source(id: %q) { name } b: source(id: %q) { name } }`, first.Hex(), second.Hex()),
+		},
+		{
+			"source and releases",
+			fmt.Sprintf(
+				`{ a: source(id: %q) { name } releases(sourceIds: [%q, %q]) { totalCount } }`,
+				first.Hex(), first.Hex(), second.Hex(),
+			),
+		},
+	}
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	for _, test := range testCases {
+		mt.Run(test.name, func(mt *mtest.T) {
+			mt.AddMockResponses(graphqlSources(graphqlSource(first, 1), graphqlSource(second, 1)))
+
+			res := queryGraphQL(mt, test.query)
+			if len(res.Errors) > 0 {
+				mt.Fatalf("Unexpected errors: %v", res.Errors)
+			}
+
+			if finds := len(mt.GetAllStartedEvents()); finds != 1 {
+				mt.Errorf("Expected sources to be loaded by one query, got %d", finds)
+			}
+		})
+	}
+}
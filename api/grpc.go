@@ -0,0 +1,220 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net"
+
+	"github.com/lesnoi-kot/versions-backend/mongostore"
+	"github.com/lesnoi-kot/versions-backend/mq"
+	"github.com/lesnoi-kot/versions-backend/versionspb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type grpcServer struct {
+	versionspb.UnimplementedVersionsServiceServer
+	api *APIService
+}
+
+func newGRPCServer(api *APIService) *grpc.Server {
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(otelgrpc.UnaryServerInterceptor(), observeUnaryCalls),
+		grpc.ChainStreamInterceptor(otelgrpc.StreamServerInterceptor(), observeStreamCalls),
+	)
+	versionspb.RegisterVersionsServiceServer(server, &grpcServer{api: api})
+	return server
+}
+
+func (s *grpcServer) ListSources(ctx context.Context, req *versionspb.ListSourcesRequest) (*versionspb.ListSourcesResponse, error) {
+	q := mongostore.SourcesQuery{
+		Name:  sanitizeNameFilter(req.GetName()),
+		Page:  int(req.GetPage()),
+		Count: int(req.GetCount()),
+	}
+	if q.Count <= 0 {
+		q.Count = 10
+	} else if q.Count > maxSourcesPerPage {
+		q.Count = maxSourcesPerPage
+	}
+	if q.Page < 0 {
+		return nil, status.Error(codes.InvalidArgument, "negative page")
+	}
+
+	sources, totalCount, err := mongostore.FindSources[mongostore.Source](ctx, s.api.Store, q)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &versionspb.ListSourcesResponse{
+		TotalCount: totalCount,
+		Sources:    make([]*versionspb.Source, 0, len(sources)),
+	}
+	for _, source := range sources {
+		res.Sources = append(res.Sources, toProtoSource(source))
+	}
+
+	return res, nil
+}
+
+func (s *grpcServer) GetSource(ctx context.Context, req *versionspb.GetSourceRequest) (*versionspb.Source, error) {
+	source, err := s.getSource(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	return toProtoSource(source), nil
+}
+
+func (s *grpcServer) ListReleases(ctx context.Context, req *versionspb.ListReleasesRequest) (*versionspb.ListReleasesResponse, error) {
+	source, err := s.getSource(ctx, req.GetSourceId())
+	if err != nil {
+		return nil, err
+	}
+
+	args := releasesArgs{First: req.GetPageSize()}
+	if args.First <= 0 {
+		args.First = 20
+	}
+	if req.GetSemverOnly() {
+		semverOnly := true
+		args.Filter = &releaseFilter{SemverOnly: &semverOnly}
+	}
+	if req.GetPageToken() != "" {
+		pageToken := req.GetPageToken()
+		args.After = &pageToken
+	}
+
+	page, err := newReleaseConnection(sourceReleases(source), args)
+	if errors.Is(err, errInvalidCursor) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	} else if err != nil {
+		return nil, err
+	}
+
+	res := &versionspb.ListReleasesResponse{
+		Releases: make([]*versionspb.Release, 0, len(page.nodes)),
+	}
+	for _, node := range page.nodes {
+		res.Releases = append(res.Releases, toProtoRelease(node.sourceID, node.release))
+	}
+	if page.hasNextPage {
+		res.NextPageToken = base64.RawURLEncoding.EncodeToString([]byte(page.nodes[len(page.nodes)-1].release.ID))
+	}
+
+	return res, nil
+}
+
+func (s *grpcServer) AddSource(ctx context.Context, req *versionspb.AddSourceRequest) (*versionspb.Source, error) {
+	fetch, err := s.api.addGithubSource(ctx, mq.LaneInteractive, req.GetLink())
+	if errors.Is(err, errInvalidRepoLink) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	} else if errors.Is(err, errGithubRateLimit) {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	} else if err != nil {
+		return nil, err
+	}
+
+	return toProtoSource(fetch.Source), nil
+}
+
+func (s *grpcServer) WatchReleases(req *versionspb.WatchReleasesRequest, stream versionspb.VersionsService_WatchReleasesServer) error {
+	ctx := stream.Context()
+
+	sourceIDs := make([]primitive.ObjectID, 0, len(req.GetSourceIds()))
+	for _, id := range req.GetSourceIds() {
+		sourceID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, "invalid source id")
+		}
+		sourceIDs = append(sourceIDs, sourceID)
+	}
+
+	changes, err := s.api.Store.WatchSourceEvents(ctx, []string{mongostore.EventReleaseAdded}, sourceIDs...)
+	if err != nil {
+		return err
+	}
+	defer changes.Close(context.Background())
+
+	for changes.Next(ctx) {
+		change := new(mongostore.SourceEventChange)
+		if err := changes.Decode(change); err != nil {
+			return err
+		}
+
+		event := change.FullDocument
+		if event.Release == nil {
+			continue
+		}
+
+		if err := stream.Send(toProtoRelease(event.SourceID, event.Release)); err != nil {
+			return err
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return changes.Err()
+}
+
+func (s *grpcServer) getSource(ctx context.Context, id string) (*mongostore.Source, error) {
+	sourceID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid source id")
+	}
+
+	source, err := s.api.Store.GetSource(ctx, sourceID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, status.Error(codes.NotFound, "source not found")
+	} else if err != nil {
+		return nil, err
+	}
+
+	return source, nil
+}
+
+func toProtoSource(source *mongostore.Source) *versionspb.Source {
+	return &versionspb.Source{
+		Id:          source.ID.Hex(),
+		Owner:       source.Owner,
+		Name:        source.Name,
+		Description: source.Description,
+		Url:         source.URL,
+		IsFetching:  source.IsFetching,
+		CreatedAt:   timestamppb.New(source.CreatedAt),
+		UpdatedAt:   timestamppb.New(source.UpdatedAt),
+	}
+}
+
+func toProtoRelease(sourceID primitive.ObjectID, release *mongostore.Release) *versionspb.Release {
+	return &versionspb.Release{
+		Id:           release.ID,
+		SourceId:     sourceID.Hex(),
+		Name:         release.Name,
+		TagName:      release.TagName,
+		Url:          release.URL,
+		PublishedAt:  timestamppb.New(release.PublishedAt),
+		IsSemver:     release.IsSemver,
+		Major:        release.Major,
+		Minor:        release.Minor,
+		Patch:        release.Patch,
+		IsPrerelease: release.IsPrerelease,
+	}
+}
+
+func (a APIService) StartGRPC(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	return a.grpcServer.Serve(listener)
+}
@@ -0,0 +1,12 @@
+package api
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/lesnoi-kot/versions-backend/health"
+)
+
+// getHealth reports whether the dependencies of the service are reachable.
+func (api *APIService) getHealth(c echo.Context) error {
+	report := health.Check(c.Request().Context(), api.Store, api.MQ)
+	return c.JSON(report.Status(), report)
+}
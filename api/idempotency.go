@@ -0,0 +1,154 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lesnoi-kot/versions-backend/mongostore"
+)
+
+const (
+	headerIdempotencyKey      = "Idempotency-Key"
+	headerIdempotencyReplayed = "Idempotency-Replayed"
+
+	// idempotencyWriteTimeout bounds releasing a key and saving a response,
+	// which are not canceled when the client disconnects.
+	idempotencyWriteTimeout = 5 * time.Second
+)
+
+// Headers of a response which are replayed along with its body.
+var idempotentResponseHeaders = []string{
+	echo.HeaderContentType,
+	echo.HeaderLocation,
+	"Retry-After",
+}
+
+// idempotent replays the saved response of a request with the same
+// Idempotency-Key header. Responses of failed or panicked requests are not
+// saved, so they can be retried with the same key.
+func (api *APIService) idempotent(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key := c.Request().Header.Get(headerIdempotencyKey)
+		if key == "" {
+			return next(c)
+		}
+
+		requestHash, err := hashRequest(c.Request())
+		if err != nil {
+			return err
+		}
+
+		ctx := c.Request().Context()
+
+		idempotencyKey, reserved, err := api.Store.ReserveIdempotencyKey(ctx, key, requestHash)
+		if err != nil {
+			return err
+		}
+
+		if !reserved {
+			if idempotencyKey.RequestHash != requestHash {
+				return echo.NewHTTPError(http.StatusUnprocessableEntity, "idempotency key is used by another request")
+			}
+			if idempotencyKey.Response == nil {
+				return echo.NewHTTPError(http.StatusConflict, "request with the idempotency key is in progress")
+			}
+
+			return replayResponse(c, idempotencyKey.Response)
+		}
+
+		// The key is released unless the response is saved, also when the
+		// handler panics. The panic goes on after the release.
+		var saved bool
+		defer func() {
+			if saved {
+				return
+			}
+
+			releaseCtx, cancel := context.WithTimeout(withoutCancel(ctx), idempotencyWriteTimeout)
+			defer cancel()
+
+			if err := api.Store.ReleaseIdempotencyKey(releaseCtx, key); err != nil {
+				c.Logger().Errorf("Idempotency key release error: %s", err)
+			}
+		}()
+
+		body := new(bytes.Buffer)
+		res := c.Response()
+		res.Writer = &teeResponseWriter{ResponseWriter: res.Writer, body: body}
+
+		if err := next(c); err != nil {
+			return err
+		}
+
+		stored := &mongostore.StoredResponse{
+			Status: res.Status,
+			Header: make(map[string][]string),
+			Body:   body.Bytes(),
+		}
+		for _, name := range idempotentResponseHeaders {
+			if values := res.Header().Values(name); len(values) > 0 {
+				stored.Header[name] = values
+			}
+		}
+
+		// The handler has made its changes, so the response is saved even if
+		// the client is gone.
+		saveCtx, cancel := context.WithTimeout(withoutCancel(ctx), idempotencyWriteTimeout)
+		defer cancel()
+
+		if err := api.Store.SaveIdempotentResponse(saveCtx, key, stored); err != nil {
+			c.Logger().Errorf("Idempotent response saving error: %s", err)
+		} else {
+			saved = true
+		}
+
+		return nil
+	}
+}
+
+// hashRequest identifies the request by its method, path and body. The body
+// is read and restored for the handler.
+func hashRequest(req *http.Request) (string, error) {
+	hash := sha256.New()
+	io.WriteString(hash, req.Method+" "+req.URL.RequestURI()+"\n")
+
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return "", err
+		}
+
+		hash.Write(body)
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func replayResponse(c echo.Context, stored *mongostore.StoredResponse) error {
+	header := c.Response().Header()
+	for name, values := range stored.Header {
+		header[name] = values
+	}
+	header.Set(headerIdempotencyReplayed, "true")
+
+	c.Response().WriteHeader(stored.Status)
+	_, err := c.Response().Write(stored.Body)
+	return err
+}
+
+type teeResponseWriter struct {
+	http.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *teeResponseWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
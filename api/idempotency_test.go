@@ -0,0 +1,38 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHashRequest(t *testing.T) {
+	newRequest := func(target, body string) *http.Request {
+		return httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	}
+
+	req := newRequest("/sources", "link=https://github.com/a/b")
+	hash, err := hashRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body, _ := io.ReadAll(req.Body); string(body) != "link=https://github.com/a/b" {
+		t.Errorf("Request body is not restored: %q", body)
+	}
+
+	if sameHash, _ := hashRequest(newRequest("/sources", "link=https://github.com/a/b")); sameHash != hash {
+		t.Errorf("Hashes of the same requests differ")
+	}
+
+	for _, other := range []*http.Request{
+		newRequest("/sources", "link=https://github.com/a/c"),
+		newRequest("/sources/import", "link=https://github.com/a/b"),
+	} {
+		if otherHash, _ := hashRequest(other); otherHash == hash {
+			t.Errorf("Hash of %s matches another request", other.URL)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/google/go-github/v53/github"
+	"github.com/labstack/echo/v4"
+	"github.com/lesnoi-kot/versions-backend/common"
+	"github.com/lesnoi-kot/versions-backend/mongostore"
+	"github.com/lesnoi-kot/versions-backend/mq"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	maxImportRepos = 1000
+
+	// Imports wait for the rate limit reset when less than this part of the
+	// limit is left, so interactive requests are not starved.
+	githubReservedRateDivisor = 10
+
+	// A running import is renewed at this interval. Imports which were not
+	// renewed for the stale period are resumed by another API instance.
+	importRenewInterval = 1 * time.Minute
+	importStalePeriod   = 5 * time.Minute
+)
+
+var githubLoginRegexp = regexp.MustCompile(`^[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,38})$`)
+
+type ImportSourcesDTO struct {
+	Org   string   `json:"org"`
+	User  string   `json:"user"`
+	Links []string `json:"links"`
+}
+
+// importItem is either a listed repository or a link to look up.
+type importItem struct {
+	link string
+	repo *github.Repository
+}
+
+func (api *APIService) importSources(c echo.Context) error {
+	req := new(ImportSourcesDTO)
+	if err := c.Bind(req); err != nil {
+		return echo.ErrBadRequest
+	}
+
+	var kind, target string
+	switch {
+	case req.Org != "" && req.User == "" && len(req.Links) == 0:
+		kind, target = mongostore.ImportKindOrg, req.Org
+	case req.User != "" && req.Org == "" && len(req.Links) == 0:
+		kind, target = mongostore.ImportKindUserStars, req.User
+	case len(req.Links) > 0 && req.Org == "" && req.User == "":
+		kind = mongostore.ImportKindLinks
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "exactly one of org, user or links is required")
+	}
+
+	if target != "" && !githubLoginRegexp.MatchString(target) {
+		return echo.ErrBadRequest
+	}
+	if len(req.Links) > maxImportRepos {
+		return echo.NewHTTPError(http.StatusBadRequest, "too many links")
+	}
+
+	imp, err := api.Store.CreateImport(c.Request().Context(), kind, target, req.Links)
+	if err != nil {
+		return err
+	}
+
+	api.runTask(func(ctx context.Context) {
+		api.runImport(ctx, imp)
+	})
+
+	c.Response().Header().Set(echo.HeaderLocation, "/sources/import/"+imp.ID.Hex())
+	return c.JSON(http.StatusAccepted, imp)
+}
+
+func (api *APIService) getImport(c echo.Context) error {
+	importID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	imp, err := api.Store.GetImport(c.Request().Context(), importID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return echo.ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, imp)
+}
+
+// StartImportReclaimer resumes imports of stopped API instances until the
+// service is shut down.
+func (api *APIService) StartImportReclaimer() {
+	api.runTask(api.reclaimImports)
+}
+
+func (api *APIService) reclaimImports(ctx context.Context) {
+	ticker := time.NewTicker(importRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			imp, err := api.Store.ClaimStaleImport(ctx, importStalePeriod)
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				break
+			} else if err != nil {
+				if ctx.Err() == nil {
+					api.handler.Logger.Errorf("Stale imports reclaiming error: %s", err)
+				}
+				break
+			}
+
+			api.handler.Logger.Infof("Resuming stale import %s", imp.ID.Hex())
+			api.runTask(func(ctx context.Context) {
+				api.runImport(ctx, imp)
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runImport imports the repos while renewing the import. An import stopped by
+// the shutdown is left unfinished, so another instance resumes it.
+func (api *APIService) runImport(ctx context.Context, imp *mongostore.Import) {
+	renewCtx, stopRenewing := context.WithCancel(ctx)
+	go api.renewImport(renewCtx, imp.ID)
+
+	err := api.importRepos(ctx, imp)
+	stopRenewing()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	finishCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := api.Store.FinishImport(finishCtx, imp.ID, err); err != nil {
+		api.handler.Logger.Errorf("Failed to finish import %s: %s", imp.ID.Hex(), err)
+	}
+}
+
+func (api *APIService) renewImport(ctx context.Context, importID primitive.ObjectID) {
+	ticker := time.NewTicker(importRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := api.Store.RenewImport(ctx, importID); err != nil && ctx.Err() == nil {
+			api.handler.Logger.Errorf("Failed to renew import %s: %s", importID.Hex(), err)
+		}
+	}
+}
+
+func (api *APIService) importRepos(ctx context.Context, imp *mongostore.Import) error {
+	items, err := api.listImportItems(ctx, imp)
+	if err != nil {
+		return err
+	}
+
+	if err := api.Store.StartImport(ctx, imp.ID, len(items)); err != nil {
+		return err
+	}
+
+	// A resumed import skips the items processed before.
+	if imp.Processed < len(items) {
+		items = items[imp.Processed:]
+	} else {
+		items = nil
+	}
+
+	seen := make(map[string]bool)
+
+	for _, item := range items {
+		progress, err := api.importItem(ctx, item, seen)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			progress = mongostore.ImportProgress{
+				Failed: 1,
+				Errors: []mongostore.ImportError{{Item: item.name(), Error: err.Error()}},
+			}
+		}
+
+		progress.Processed = 1
+		if err := api.Store.AddImportProgress(ctx, imp.ID, progress); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (api *APIService) importItem(ctx context.Context, item importItem, seen map[string]bool) (mongostore.ImportProgress, error) {
+	repo := item.repo
+	if repo == nil {
+		owner, name, err := common.ParseGithubRepoLink(item.link)
+		if err != nil {
+			return mongostore.ImportProgress{}, errInvalidRepoLink
+		}
+
+		err = api.callGithub(ctx, func() (res *github.Response, err error) {
+			repo, res, err = api.githubClient().Repositories.Get(ctx, owner, name)
+			return res, err
+		})
+		if err != nil {
+			return mongostore.ImportProgress{}, err
+		}
+	}
+
+	externalID := fmt.Sprintf("github/%d", repo.GetID())
+	if seen[externalID] {
+		return mongostore.ImportProgress{Skipped: 1}, nil
+	}
+	seen[externalID] = true
+
+	exists, err := api.Store.SourceExists(ctx, externalID)
+	if err != nil {
+		return mongostore.ImportProgress{}, err
+	}
+	if exists {
+		return mongostore.ImportProgress{Skipped: 1}, nil
+	}
+
+	if _, err := api.saveGithubSource(ctx, mq.LaneBackground, repo); err != nil {
+		return mongostore.ImportProgress{}, err
+	}
+
+	return mongostore.ImportProgress{Added: 1}, nil
+}
+
+func (api *APIService) listImportItems(ctx context.Context, imp *mongostore.Import) ([]importItem, error) {
+	items := make([]importItem, 0, len(imp.Links))
+
+	if imp.Kind == mongostore.ImportKindLinks {
+		for _, link := range imp.Links {
+			items = append(items, importItem{link: link})
+		}
+		return items, nil
+	}
+
+	client := api.githubClient()
+	listOptions := github.ListOptions{PerPage: 100}
+
+	for len(items) < maxImportRepos {
+		var (
+			repos []*github.Repository
+			res   *github.Response
+		)
+
+		err := api.callGithub(ctx, func() (_ *github.Response, err error) {
+			if imp.Kind == mongostore.ImportKindOrg {
+				repos, res, err = client.Repositories.ListByOrg(ctx, imp.Target, &github.RepositoryListByOrgOptions{
+					ListOptions: listOptions,
+				})
+				return res, err
+			}
+
+			var starred []*github.StarredRepository
+			starred, res, err = client.Activity.ListStarred(ctx, imp.Target, &github.ActivityListStarredOptions{
+				ListOptions: listOptions,
+			})
+			repos = make([]*github.Repository, 0, len(starred))
+			for _, star := range starred {
+				repos = append(repos, star.GetRepository())
+			}
+			return res, err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, repo := range repos {
+			if len(items) < maxImportRepos {
+				items = append(items, importItem{repo: repo})
+			}
+		}
+
+		if res.NextPage == 0 {
+			break
+		}
+		listOptions.Page = res.NextPage
+	}
+
+	return items, nil
+}
+
+func (item importItem) name() string {
+	if item.repo != nil {
+		return item.repo.GetFullName()
+	}
+	return item.link
+}
+
+// callGithub paces GitHub calls of background tasks and waits out rate limits
+// instead of failing.
+func (api *APIService) callGithub(ctx context.Context, call func() (*github.Response, error)) error {
+	for {
+		if err := api.githubLimiter.Wait(ctx); err != nil {
+			return err
+		}
+
+		res, err := call()
+
+		var rateLimitErr *github.RateLimitError
+		var abuseErr *github.AbuseRateLimitError
+
+		switch {
+		case errors.As(err, &rateLimitErr):
+			if err := sleep(ctx, time.Until(rateLimitErr.Rate.Reset.Time)); err != nil {
+				return err
+			}
+			continue
+		case errors.As(err, &abuseErr):
+			if err := sleep(ctx, abuseErr.GetRetryAfter()); err != nil {
+				return err
+			}
+			continue
+		case err != nil:
+			return err
+		}
+
+		if res != nil && res.Rate.Limit > 0 && res.Rate.Remaining < res.Rate.Limit/githubReservedRateDivisor {
+			if err := sleep(ctx, time.Until(res.Rate.Reset.Time)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
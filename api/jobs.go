@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lesnoi-kot/versions-backend/mongostore"
+	"github.com/lesnoi-kot/versions-backend/mq"
+	"github.com/lesnoi-kot/versions-backend/tracing"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const maxSourceJobs = 50
+
+// FetchRequestDTO is returned when releases of a source are requested to be
+// fetched. Job is nil for fetches requested before jobs were tracked.
+type FetchRequestDTO struct {
+	Source *mongostore.Source `json:"source"`
+	Job    *mongostore.Job    `json:"job"`
+}
+
+func (api *APIService) getJob(c echo.Context) error {
+	jobID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	job, err := api.Store.GetJob(c.Request().Context(), jobID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return echo.ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, job)
+}
+
+func (api *APIService) getSourceJobs(c echo.Context) error {
+	sourceID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	ctx := c.Request().Context()
+
+	if _, err := api.Store.GetSource(ctx, sourceID); errors.Is(err, mongo.ErrNoDocuments) {
+		return echo.ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	jobs, err := api.Store.GetSourceJobs(ctx, sourceID, maxSourceJobs)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, jobs)
+}
+
+// requestFetch queues a fetch of the source, creates its job and saves its
+// message to the outbox in the transaction.
+func (api *APIService) requestFetch(sessCtx mongo.SessionContext, lane mq.Lane, source *mongostore.Source) (*mongostore.Job, error) {
+	if err := api.Store.QueueFetch(sessCtx, source.ID); err != nil {
+		return nil, err
+	}
+	source.IsFetching = true
+
+	job, err := api.Store.CreateJob(sessCtx, source.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(&mq.GithubRepoRequestMessage{
+		Owner:    source.Owner,
+		Repo:     source.Name,
+		SourceID: source.ID.Hex(),
+		JobID:    job.ID.Hex(),
+
+		DeduplicationID: primitive.NewObjectID().Hex(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := api.Store.AddOutboxMessage(sessCtx, string(lane), body, tracing.Inject(sessCtx)); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// acceptFetchRequest responds with the fetched source and points to its job.
+func acceptFetchRequest(c echo.Context, req *FetchRequestDTO) error {
+	setJobLocation(c, req.Job)
+	return c.JSON(http.StatusAccepted, req)
+}
+
+func setJobLocation(c echo.Context, job *mongostore.Job) {
+	if job != nil {
+		c.Response().Header().Set(echo.HeaderLocation, "/jobs/"+job.ID.Hex())
+	}
+}
+
+// activeFetchRequest returns the job of a source which is already fetching.
+func (api *APIService) activeFetchRequest(ctx context.Context, source *mongostore.Source) (*FetchRequestDTO, error) {
+	job, err := api.Store.GetActiveJob(ctx, source.ID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &FetchRequestDTO{Source: source}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &FetchRequestDTO{Source: source, Job: job}, nil
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lesnoi-kot/versions-backend/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// tracedServiceName names the server of spans of requests.
+const tracedServiceName = "versions-api"
+
+// skipTracing leaves out probes and scrapes from traces.
+func skipTracing(c echo.Context) bool {
+	path := c.Request().URL.Path
+	return path == "/health" || path == "/metrics"
+}
+
+// observeRequests records the latency of requests by their route pattern, so
+// paths of different sources share a series. It should run before the logger,
+// which writes responses of errors.
+func observeRequests(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+
+		route := c.Path()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		metrics.HTTPRequestDuration.
+			WithLabelValues(c.Request().Method, route, strconv.Itoa(c.Response().Status)).
+			Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
+
+// observeUnaryCalls records the latency of gRPC calls by their method and
+// status code.
+func observeUnaryCalls(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	res, err := handler(ctx, req)
+	observeCall(info.FullMethod, start, err)
+
+	return res, err
+}
+
+// observeStreamCalls records the duration of gRPC streams, which lasts until
+// the client leaves.
+func observeStreamCalls(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, stream)
+	observeCall(info.FullMethod, start, err)
+
+	return err
+}
+
+func observeCall(method string, start time.Time, err error) {
+	metrics.GRPCRequestDuration.
+		WithLabelValues(method, status.Code(err).String()).
+		Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/labstack/echo/v4"
+)
+
+//go:embed openapi.json
+var openapiSpec []byte
+
+func loadOpenAPISpec() (*openapi3.T, routers.Router, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(openapiSpec)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := doc.Validate(openapi3.NewLoader().Context); err != nil {
+		return nil, nil, err
+	}
+
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return doc, router, nil
+}
+
+func getOpenAPISpec(c echo.Context) error {
+	return c.Blob(http.StatusOK, echo.MIMEApplicationJSONCharsetUTF8, openapiSpec)
+}
+
+// validateRequests rejects requests which do not conform to the OpenAPI
+// document. Routes missing from the document are passed as is.
+func validateRequests(router routers.Router) echo.MiddlewareFunc {
+	options := &openapi3filter.Options{
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+
+			route, pathParams, err := router.FindRoute(req)
+			if err != nil {
+				return next(c)
+			}
+
+			err = openapi3filter.ValidateRequest(req.Context(), &openapi3filter.RequestValidationInput{
+				Request:    req,
+				PathParams: pathParams,
+				Route:      route,
+				Options:    options,
+			})
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/labstack/echo/v4"
+	"github.com/lesnoi-kot/versions-backend/mongostore"
+	"github.com/lesnoi-kot/versions-backend/mq"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestOpenAPIRoutesMatchHandlers(t *testing.T) {
+	doc, _, err := loadOpenAPISpec()
+	if err != nil {
+		t.Fatalf("OpenAPI document is invalid: %s", err)
+	}
+
+	api, err := NewAPI(APIConfig{})
+	if err != nil {
+		t.Fatalf("API setup error: %s", err)
+	}
+
+	served := make(map[string]bool)
+
+	for _, route := range api.handler.Routes() {
+		path := route.Path
+		for _, segment := range strings.Split(path, "/") {
+			if strings.HasPrefix(segment, ":") {
+				path = strings.Replace(path, segment, "{"+segment[1:]+"}", 1)
+			}
+		}
+
+		key := route.Method + " " + path
+		served[key] = true
+
+		if doc.Paths.Find(path) == nil || doc.Paths.Find(path).GetOperation(route.Method) == nil {
+			t.Errorf("Route %s is not described in the OpenAPI document", key)
+		}
+	}
+
+	for path, item := range doc.Paths {
+		for method := range item.Operations() {
+			if key := method + " " + path; !served[key] {
+				t.Errorf("Operation %s is not served", key)
+			}
+		}
+	}
+}
+
+// connectedQueue stubs the queue of handlers which only report its state.
+type connectedQueue struct {
+	mq.Queue
+	connected bool
+}
+
+func (q connectedQueue) IsConnected() bool {
+	return q.connected
+}
+
+func TestOpenAPIResponsesMatchHandlers(t *testing.T) {
+	_, router, err := loadOpenAPISpec()
+	if err != nil {
+		t.Fatalf("OpenAPI document is invalid: %s", err)
+	}
+
+	openapi3filter.RegisterBodyDecoder("text/calendar", openapi3filter.FileBodyDecoder)
+	defer openapi3filter.UnregisterBodyDecoder("text/calendar")
+
+	// Sources are added from the fake GitHub.
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/a/b" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id": 1, "name": "b", "owner": {"login": "a"}, "html_url": "https://github.com/a/b"}`)
+	}))
+	defer github.Close()
+
+	githubURL, err := url.Parse(github.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var manifest bytes.Buffer
+	manifestForm := multipart.NewWriter(&manifest)
+	manifestFile, err := manifestForm.CreateFormFile("manifest", "package.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(manifestFile, `{"dependencies": {}}`)
+	manifestForm.Close()
+
+	sourceID := primitive.NewObjectID()
+	jobID := primitive.NewObjectID()
+	now := time.Now()
+
+	source := bson.D{
+		{"_id", sourceID},
+		{"created_at", now},
+		{"updated_at", now},
+		{"external_id", "github/1"},
+		{"owner", "a"},
+		{"name", "b"},
+		{"description", "Repo b"},
+		{"url", "https://github.com/a/b"},
+		{"is_fetching", false},
+		{"releases", bson.A{bson.D{
+			{"id", "RE_kwDOJ"},
+			{"name", "Release 1.2.3"},
+			{"tag_name", "v1.2.3"},
+			{"url", "https://github.com/a/b/releases/tag/v1.2.3"},
+			{"published_at", now},
+			{"is_semver", true},
+			{"major", 1},
+			{"minor", 2},
+			{"patch", 3},
+		}}},
+	}
+	refreshedSource := bson.D{
+		{"_id", sourceID},
+		{"owner", "a"},
+		{"name", "b"},
+		{"url", "https://github.com/a/b"},
+		{"is_fetching", false},
+		{"refresh_requested_at", now},
+	}
+	job := bson.D{
+		{"_id", jobID},
+		{"source_id", sourceID},
+		{"status", mongostore.JobStatusFailed},
+		{"attempts", 1},
+		{"error", "not found"},
+		{"pages_fetched", 2},
+		{"releases_fetched", 100},
+		{"created_at", now},
+		{"updated_at", now},
+		{"started_at", now},
+		{"finished_at", now},
+	}
+	imp := bson.D{
+		{"_id", primitive.NewObjectID()},
+		{"kind", mongostore.ImportKindOrg},
+		{"target", "a"},
+		{"status", mongostore.ImportStatusRunning},
+		{"total", 2},
+		{"processed", 1},
+		{"failed", 1},
+		{"errors", bson.A{bson.D{{"item", "a/b"}, {"error", "not found"}}}},
+		{"created_at", now},
+		{"updated_at", now},
+	}
+
+	found := func(collection string, docs ...bson.D) bson.D {
+		return mtest.CreateCursorResponse(0, mongostore.DatabaseName+"."+collection, mtest.FirstBatch, docs...)
+	}
+	modified := func(doc any) bson.D {
+		return bson.D{{"ok", 1}, {"value", doc}}
+	}
+	ok := bson.D{{"ok", 1}}
+	written := bson.D{{"ok", 1}, {"n", 1}, {"nModified", 1}}
+
+	type testCase struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		connected   bool
+		responses   []bson.D
+		status      int
+	}
+
+	testCases := []testCase{
+		{"sources", http.MethodGet, "/sources", "", "", true, []bson.D{
+			found(mongostore.SourcesCollectionName, source),
+			found(mongostore.SourcesCollectionName, bson.D{{"n", 1}}),
+		}, http.StatusOK},
+		{"source", http.MethodGet, "/sources/" + sourceID.Hex(), "", "", true, []bson.D{
+			found(mongostore.SourcesCollectionName, source),
+		}, http.StatusOK},
+		{"added source", http.MethodPost, "/sources", echo.MIMEApplicationForm, "link=https://github.com/a/b", true, []bson.D{
+			modified(refreshedSource), written, written, written, ok,
+		}, http.StatusAccepted},
+		{"deleted source", http.MethodDelete, "/sources/" + sourceID.Hex(), "", "", true, []bson.D{
+			modified(source),
+		}, http.StatusNoContent},
+		{"source calendar", http.MethodGet, "/sources/" + sourceID.Hex() + "/releases.ics", "", "", true, []bson.D{
+			found(mongostore.SourcesCollectionName, source),
+		}, http.StatusOK},
+		{"sources calendar", http.MethodGet, "/sources/releases.ics?id=" + sourceID.Hex(), "", "", true, []bson.D{
+			found(mongostore.SourcesCollectionName, source),
+		}, http.StatusOK},
+		{"missing source", http.MethodGet, "/sources/" + sourceID.Hex(), "", "", true, []bson.D{
+			found(mongostore.SourcesCollectionName),
+		}, http.StatusNotFound},
+		{"restored source", http.MethodPost, "/sources/" + sourceID.Hex() + "/restore", "", "", true, []bson.D{
+			modified(refreshedSource), written, written, written, ok,
+		}, http.StatusAccepted},
+		{"source which is not deleted", http.MethodPost, "/sources/" + sourceID.Hex() + "/restore", "", "", true, []bson.D{
+			modified(nil), ok, found(mongostore.SourcesCollectionName, source),
+		}, http.StatusOK},
+		{"refreshed source", http.MethodPost, "/sources/" + sourceID.Hex() + "/refresh", "", "", true, []bson.D{
+			modified(refreshedSource), written, written, written, ok,
+		}, http.StatusAccepted},
+		{"recently refreshed source", http.MethodPost, "/sources/" + sourceID.Hex() + "/refresh", "", "", true, []bson.D{
+			modified(nil), found(mongostore.SourcesCollectionName, refreshedSource), ok,
+		}, http.StatusTooManyRequests},
+		{"source jobs", http.MethodGet, "/sources/" + sourceID.Hex() + "/jobs", "", "", true, []bson.D{
+			found(mongostore.SourcesCollectionName, source),
+			found(mongostore.JobsCollectionName, job),
+		}, http.StatusOK},
+		{"job", http.MethodGet, "/jobs/" + jobID.Hex(), "", "", true, []bson.D{
+			found(mongostore.JobsCollectionName, job),
+		}, http.StatusOK},
+		{"import", http.MethodGet, "/sources/import/" + primitive.NewObjectID().Hex(), "", "", true, []bson.D{
+			found(mongostore.ImportsCollectionName, imp),
+		}, http.StatusOK},
+		{"started import", http.MethodPost, "/sources/import", echo.MIMEApplicationJSON, `{"links": ["https://github.com/a/b"]}`, true, []bson.D{
+			written,
+		}, http.StatusAccepted},
+		{"outdated report", http.MethodPost, "/reports/outdated", manifestForm.FormDataContentType(), manifest.String(), true, nil, http.StatusOK},
+		{"healthy", http.MethodGet, "/health", "", "", true, []bson.D{ok}, http.StatusOK},
+		{"unhealthy", http.MethodGet, "/health", "", "", false, []bson.D{ok}, http.StatusServiceUnavailable},
+	}
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	for _, test := range testCases {
+		mt.Run(test.name, func(mt *mtest.T) {
+			mt.AddMockResponses(test.responses...)
+
+			api, err := NewAPI(APIConfig{
+				Store: &mongostore.Store{Client: mt.Client},
+				MQ:    connectedQueue{connected: test.connected},
+			})
+			if err != nil {
+				mt.Fatalf("API setup error: %s", err)
+			}
+			api.githubURL = githubURL
+
+			// Background tasks, such as imports, would take the mocked
+			// responses, so they are stopped beforehand.
+			api.cancelTasks()
+			defer api.tasks.Wait()
+
+			req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			if test.contentType != "" {
+				req.Header.Set("Content-Type", test.contentType)
+			}
+
+			rec := httptest.NewRecorder()
+			api.handler.ServeHTTP(rec, req)
+
+			if rec.Code != test.status {
+				mt.Fatalf("Expected status %d, got %d: %s", test.status, rec.Code, rec.Body)
+			}
+
+			route, pathParams, err := router.FindRoute(req)
+			if err != nil {
+				mt.Fatalf("Route is not found: %s", err)
+			}
+
+			err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: &openapi3filter.RequestValidationInput{
+					Request:    req,
+					PathParams: pathParams,
+					Route:      route,
+				},
+				Status:  rec.Code,
+				Header:  rec.Header(),
+				Body:    io.NopCloser(rec.Body),
+				Options: &openapi3filter.Options{IncludeResponseStatus: true},
+			})
+			if err != nil {
+				mt.Errorf("Response drifted from the OpenAPI document: %s", err)
+			}
+		})
+	}
+}
+
+func TestValidateRequests(t *testing.T) {
+	api, err := NewAPI(APIConfig{})
+	if err != nil {
+		t.Fatalf("API setup error: %s", err)
+	}
+
+	type testCase struct {
+		method      string
+		target      string
+		contentType string
+		body        string
+	}
+
+	testCases := []testCase{
+		{http.MethodGet, "/sources?page=first", "", ""},
+		{http.MethodGet, "/sources/not-an-id", "", ""},
+		{http.MethodDelete, "/sources/not-an-id", "", ""},
+		{http.MethodGet, "/sources/releases.ics", "", ""},
+		{http.MethodPost, "/sources", "application/x-www-form-urlencoded", "url=https://github.com/a/b"},
+		{http.MethodPost, "/graphql", "application/json", `{"variables": {}}`},
+		{http.MethodPost, "/sources/import", "application/json", `{"org": "a", "repos": []}`},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.method+" "+test.target, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+			if test.contentType != "" {
+				req.Header.Set("Content-Type", test.contentType)
+			}
+
+			rec := httptest.NewRecorder()
+			api.handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400, got %d", rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lesnoi-kot/versions-backend/mq"
+	"github.com/lesnoi-kot/versions-backend/tracing"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	outboxPollInterval = 1 * time.Second
+
+	// outboxLock is how long a claimed message is not relayed by others.
+	outboxLock = 30 * time.Second
+)
+
+// StartOutboxRelay publishes messages of the outbox until the service is shut
+// down.
+func (api *APIService) StartOutboxRelay() {
+	api.runTask(api.relayOutbox)
+}
+
+// wakeOutboxRelay makes the relay publish messages of a committed transaction
+// without waiting for the next poll.
+func (api *APIService) wakeOutboxRelay() {
+	select {
+	case api.outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+func (api *APIService) relayOutbox(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			err := api.relayOutboxMessage(ctx)
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				break
+			} else if err != nil {
+				if ctx.Err() == nil {
+					api.handler.Logger.Errorf("Outbox message relaying error: %s", err)
+				}
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-api.outboxWake:
+		}
+	}
+}
+
+// relayOutboxMessage publishes the oldest unsent message and marks it sent
+// once the broker confirms it. A message may be published twice if marking
+// fails, the dataloader discards the duplicate by its deduplication ID.
+func (api *APIService) relayOutboxMessage(ctx context.Context) error {
+	msg, err := api.Store.ClaimOutboxMessage(ctx, outboxLock)
+	if err != nil {
+		return err
+	}
+
+	req := new(mq.GithubRepoRequestMessage)
+	if err := json.Unmarshal(msg.Body, req); err != nil {
+		return err
+	}
+
+	// The request is traced as a part of the change which saved it.
+	if err := api.MQ.PushRepoRequest(tracing.Extract(ctx, msg.TraceContext), mq.Lane(msg.Lane), req); err != nil {
+		return err
+	}
+
+	return api.Store.MarkOutboxMessageSent(ctx, msg.ID)
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/labstack/echo/v4"
+	"github.com/lesnoi-kot/versions-backend/manifest"
+	"github.com/lesnoi-kot/versions-backend/mongostore"
+	"github.com/lesnoi-kot/versions-backend/mq"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	maxManifestDependencies = 200
+	manifestResolveWorkers  = 8
+)
+
+// createOutdatedReport maps dependencies of an uploaded manifest to sources,
+// starts tracking missing ones and compares declared versions with the latest
+// releases.
+func (api *APIService) createOutdatedReport(c echo.Context) error {
+	fileHeader, err := c.FormFile("manifest")
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	ecosystem, deps, err := manifest.Parse(fileHeader.Filename, data)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if len(deps) > maxManifestDependencies {
+		return echo.NewHTTPError(http.StatusBadRequest, "too many dependencies")
+	}
+
+	ctx := c.Request().Context()
+	resolver := manifest.NewResolver()
+	entries := make([]manifest.Entry, len(deps))
+
+	var wg sync.WaitGroup
+	jobs := make(chan int)
+
+	for i := 0; i < manifestResolveWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				entries[j] = api.checkDependency(ctx, resolver, deps[j])
+			}
+		}()
+	}
+
+	for i := range deps {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	report := manifest.NewReport(fileHeader.Filename, ecosystem, entries)
+
+	if c.QueryParam("format") == "markdown" || strings.Contains(c.Request().Header.Get(echo.HeaderAccept), "text/markdown") {
+		c.Response().Header().Set(echo.HeaderContentType, "text/markdown; charset=utf-8")
+		c.Response().WriteHeader(http.StatusOK)
+		return report.WriteMarkdown(c.Response())
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+func (api *APIService) checkDependency(ctx context.Context, resolver *manifest.Resolver, dep manifest.Dependency) manifest.Entry {
+	entry := manifest.Entry{Dependency: dep}
+
+	link, err := resolver.ResolveGithubRepo(ctx, dep)
+	if err != nil {
+		entry.Status = manifest.StatusUnresolved
+		if !errors.Is(err, manifest.ErrRepoNotFound) {
+			entry.Note = err.Error()
+		}
+		return entry
+	}
+
+	entry.URL = link
+
+	source, err := api.Store.GetSourceBy(
+		ctx,
+		bson.D{
+			{"url", primitive.Regex{Pattern: "^" + regexp.QuoteMeta(link) + "$", Options: "i"}},
+			{"deleted_at", nil},
+		},
+		options.FindOne().SetProjection(mongostore.SourceProjection),
+	)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// Track the missing source the same way as it is added by hand, but
+		// do not hold up sources added by users. Deleted sources are restored.
+		fetch, err := api.addGithubSource(ctx, mq.LaneBackground, link)
+		if err != nil {
+			entry.Status = manifest.StatusUnknown
+			entry.Note = err.Error()
+			return entry
+		}
+		source = fetch.Source
+	} else if err != nil {
+		entry.Status = manifest.StatusUnknown
+		entry.Note = err.Error()
+		return entry
+	}
+
+	entry.SourceID = source.ID.Hex()
+
+	if source.IsFetching {
+		entry.Status = manifest.StatusPending
+		entry.Note = "releases are being fetched"
+		return entry
+	}
+
+	latest := source.LatestStableRelease()
+	if latest == nil {
+		entry.Status = manifest.StatusUnknown
+		entry.Note = "no releases"
+		return entry
+	}
+
+	entry.Latest = latest.TagName
+	if latest.IsSemver {
+		entry.Status = manifest.CompareVersions(dep.Version, semver.New(latest.Major, latest.Minor, latest.Patch, "", ""))
+	} else {
+		entry.Status = manifest.StatusUnknown
+	}
+
+	return entry
+}
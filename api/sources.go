@@ -1,9 +1,11 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/google/go-github/v53/github"
@@ -15,8 +17,27 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/oauth2"
 )
 
+const (
+	// Minimal interval between manual refreshes of a source.
+	refreshMinInterval = 5 * time.Minute
+
+	// maxSourcesPerPage caps pages of sources listed by REST and gRPC.
+	maxSourcesPerPage = 100
+)
+
+var (
+	errInvalidRepoLink = errors.New("invalid github repo link")
+	errGithubRateLimit = errors.New("github api rate limit exceeded")
+)
+
+type SourcesPageDTO struct {
+	TotalCount int64             `json:"totalCount"`
+	Data       []*BriefSourceDTO `json:"data"`
+}
+
 type BriefSourceDTO struct {
 	ID          primitive.ObjectID `bson:"_id" json:"id"`
 	Name        string             `bson:"name" json:"name"`
@@ -27,44 +48,28 @@ type BriefSourceDTO struct {
 
 func (api *APIService) getSources(c echo.Context) error {
 	q := c.QueryParams()
-	count := parseQueryParamInt(q.Get("count"), 10)
-	page := parseQueryParamInt(q.Get("page"), 0)
-	name := q.Get("name")
 
-	filters := bson.D{}
-	if name != "" {
-		filters = append(filters, bson.E{"name", primitive.Regex{sanitizeNameFilter(name), "i"}})
+	count := parseQueryParamInt(q.Get("count"), 10)
+	if count > maxSourcesPerPage {
+		count = maxSourcesPerPage
 	}
 
-	sources, err := mongostore.GetDocuments(
+	sources, totalCount, err := mongostore.FindSources[BriefSourceDTO](
 		c.Request().Context(),
 		api.Store,
-		mongostore.GetDocumentsOptions[BriefSourceDTO]{
-			Collection: mongostore.SourcesCollectionName,
-			Filter:     filters,
-			FindOptions: options.
-				Find().
-				SetSkip(int64(page * count)).
-				SetLimit(int64(count)).
-				SetMaxTime(5 * time.Second),
+		mongostore.SourcesQuery{
+			Name:  sanitizeNameFilter(q.Get("name")),
+			Page:  parseQueryParamInt(q.Get("page"), 0),
+			Count: count,
 		},
 	)
 	if err != nil {
 		return err
 	}
 
-	totalCount, err := api.Store.GetDocumentsCount(
-		c.Request().Context(),
-		mongostore.SourcesCollectionName,
-		filters,
-	)
-	if err != nil {
-		return err
-	}
-
-	return c.JSON(http.StatusOK, map[string]any{
-		"totalCount": totalCount,
-		"data":       sources,
+	return c.JSON(http.StatusOK, SourcesPageDTO{
+		TotalCount: totalCount,
+		Data:       sources,
 	})
 }
 
@@ -74,29 +79,7 @@ func (api *APIService) getSource(c echo.Context) error {
 		return echo.ErrBadRequest
 	}
 
-	source, err := api.Store.GetSourceBy(
-		c.Request().Context(),
-		bson.D{{"_id", sourceID}},
-		options.FindOne().SetProjection(bson.D{
-			{"_id", true},
-			{"created_at", true},
-			{"updated_at", true},
-			{"owner", true},
-			{"name", true},
-			{"description", true},
-			{"url", true},
-			{"is_fetching", true},
-			{"releases", bson.D{
-				{"$cond", bson.D{
-					{"if",
-						bson.D{{"$ne", bson.A{"$is_fetching", true}}},
-					},
-					{"then", "$releases"},
-					{"else", nil},
-				}},
-			}},
-		}),
-	)
+	source, err := api.Store.GetSource(c.Request().Context(), sourceID)
 	if errors.Is(err, mongo.ErrNoDocuments) {
 		return echo.ErrNotFound
 	} else if err != nil {
@@ -107,32 +90,71 @@ func (api *APIService) getSource(c echo.Context) error {
 }
 
 func (api *APIService) addSource(c echo.Context) error {
-	link := c.FormValue("link")
+	req, err := api.addGithubSource(c.Request().Context(), mq.LaneInteractive, c.FormValue("link"))
+	if errors.Is(err, errInvalidRepoLink) {
+		return echo.ErrBadRequest
+	} else if errors.Is(err, errGithubRateLimit) {
+		return echo.ErrServiceUnavailable
+	} else if err != nil {
+		return err
+	}
+
+	// The response keeps the source body of clients written before jobs were
+	// tracked, the job is only pointed to.
+	setJobLocation(c, req.Job)
+	return c.JSON(http.StatusAccepted, req.Source)
+}
+
+// addGithubSource starts tracking the repository behind the link and requests
+// its releases to be fetched in the lane.
+func (api *APIService) addGithubSource(ctx context.Context, lane mq.Lane, link string) (*FetchRequestDTO, error) {
 	owner, repo, err := common.ParseGithubRepoLink(link)
 	if err != nil {
-		return echo.ErrBadRequest
+		return nil, errInvalidRepoLink
 	}
 
-	ctx := c.Request().Context()
-	ghClient := github.NewClient(&http.Client{Timeout: 5 * time.Second})
-	repoInfo, _, err := ghClient.Repositories.Get(ctx, owner, repo)
+	repoInfo, _, err := api.githubClient().Repositories.Get(ctx, owner, repo)
 	if err != nil {
 		if _, isRateLimitError := err.(*github.RateLimitError); isRateLimitError {
-			return echo.ErrServiceUnavailable
+			return nil, errGithubRateLimit
 		}
 
-		return err
+		return nil, err
 	}
 
+	return api.saveGithubSource(ctx, lane, repoInfo)
+}
+
+func (api *APIService) githubClient() *github.Client {
+	httpClient := &http.Client{Timeout: 5 * time.Second}
+
+	if api.GithubToken != "" {
+		httpClient.Transport = &oauth2.Transport{
+			Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: api.GithubToken}),
+		}
+	}
+
+	client := github.NewClient(httpClient)
+	if api.githubURL != nil {
+		client.BaseURL = api.githubURL
+	}
+
+	return client
+}
+
+// saveGithubSource upserts the repository as a source and pushes a request to
+// fetch its releases in the same transaction, unless the source is already
+// being fetched.
+func (api *APIService) saveGithubSource(ctx context.Context, lane mq.Lane, repoInfo *github.Repository) (*FetchRequestDTO, error) {
 	externalID := fmt.Sprintf("github/%d", repoInfo.GetID())
 
 	sess, err := api.Store.StartSession()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer sess.EndSession(ctx)
 
-	source, err := sess.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+	req, err := sess.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
 		mongoResult := api.Store.
 			Database(mongostore.DatabaseName).
 			Collection(mongostore.SourcesCollectionName).
@@ -147,8 +169,10 @@ func (api *APIService) addSource(c echo.Context) error {
 						{"owner", repoInfo.GetOwner().GetLogin()},
 						{"description", repoInfo.GetDescription()},
 						{"updated_at", time.Now()},
-						{"is_fetching", true},
+						{"refresh_requested_at", time.Now()},
 					}},
+					// Adding a deleted source again restores it.
+					{"$unset", bson.D{{"deleted_at", ""}}},
 					{"$setOnInsert", bson.D{
 						{"releases", []mongostore.Release{}},
 						{"created_at", time.Now()},
@@ -158,9 +182,7 @@ func (api *APIService) addSource(c echo.Context) error {
 				options.FindOneAndUpdate().
 					SetUpsert(true).
 					SetReturnDocument(options.After).
-					SetProjection(bson.D{
-						{"releases", false},
-					}),
+					SetProjection(mongostore.SourceBriefProjection),
 			)
 
 		source := new(mongostore.Source)
@@ -168,19 +190,146 @@ func (api *APIService) addSource(c echo.Context) error {
 			return nil, err
 		}
 
-		err = api.MQ.PushRepoRequest(ctx, &mq.GithubRepoRequestMessage{
-			Owner: owner,
-			Repo:  repo,
-		})
+		// A fetch which is already queued or running is reused, a second one
+		// would only lose the fetch lease.
+		if source.IsFetching {
+			req, err := api.activeFetchRequest(sessCtx, source)
+			if err != nil || req.Job != nil {
+				return req, err
+			}
+		}
+
+		job, err := api.requestFetch(sessCtx, lane, source)
 		if err != nil {
 			return nil, err
 		}
 
-		return source, nil
+		return &FetchRequestDTO{Source: source, Job: job}, nil
 	})
 	if err != nil {
+		return nil, err
+	}
+
+	api.wakeOutboxRelay()
+	return req.(*FetchRequestDTO), nil
+}
+
+// deleteSource hides the source and stops fetching its releases. Deleted
+// sources are purged by the dataloader after the retention period.
+func (api *APIService) deleteSource(c echo.Context) error {
+	sourceID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	err = api.Store.DeleteSource(c.Request().Context(), sourceID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return echo.ErrNotFound
+	} else if err != nil {
 		return err
 	}
 
-	return c.JSON(http.StatusOK, source)
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (api *APIService) restoreSource(c echo.Context) error {
+	sourceID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	ctx := c.Request().Context()
+
+	sess, err := api.Store.StartSession()
+	if err != nil {
+		return err
+	}
+	defer sess.EndSession(ctx)
+
+	req, err := sess.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		source, err := api.Store.RestoreSource(sessCtx, sourceID)
+		if err != nil {
+			return nil, err
+		}
+
+		// Releases were not refreshed while the source was deleted.
+		job, err := api.requestFetch(sessCtx, mq.LaneInteractive, source)
+		if err != nil {
+			return nil, err
+		}
+
+		return &FetchRequestDTO{Source: source, Job: job}, nil
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// The source is not deleted, nothing to restore.
+		return api.getSource(c)
+	} else if err != nil {
+		return err
+	}
+
+	api.wakeOutboxRelay()
+	return acceptFetchRequest(c, req.(*FetchRequestDTO))
+}
+
+// refreshSource requests releases of the source to be fetched again. A refresh
+// which is already queued or running is reused.
+func (api *APIService) refreshSource(c echo.Context) error {
+	sourceID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	ctx := c.Request().Context()
+
+	sess, err := api.Store.StartSession()
+	if err != nil {
+		return err
+	}
+	defer sess.EndSession(ctx)
+
+	var started bool
+
+	result, err := sess.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		source, ok, err := api.Store.StartSourceRefresh(sessCtx, sourceID, refreshMinInterval)
+		if err != nil {
+			return nil, err
+		}
+
+		started = ok
+		if !started {
+			return &FetchRequestDTO{Source: source}, nil
+		}
+
+		job, err := api.requestFetch(sessCtx, mq.LaneInteractive, source)
+		if err != nil {
+			return nil, err
+		}
+
+		return &FetchRequestDTO{Source: source, Job: job}, nil
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return echo.ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	req := result.(*FetchRequestDTO)
+
+	if started {
+		api.wakeOutboxRelay()
+	} else {
+		source := req.Source
+		if !source.IsFetching && source.RefreshRequestedAt != nil {
+			retryAfter := time.Until(source.RefreshRequestedAt.Add(refreshMinInterval))
+			c.Response().Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			return echo.NewHTTPError(http.StatusTooManyRequests, "source was refreshed recently")
+		}
+
+		// Reuse the fetch which is already queued or running.
+		if req, err = api.activeFetchRequest(ctx, source); err != nil {
+			return err
+		}
+	}
+
+	return acceptFetchRequest(c, req)
 }
@@ -1,8 +1,10 @@
 package api
 
 import (
+	"context"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
 )
 
@@ -26,3 +28,39 @@ func sanitizeNameFilter(input string) string {
 
 	return sb.String()
 }
+
+// sleep pauses until the duration passes or the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// withoutCancel returns a context with the values of ctx, e.g. its trace,
+// which is not canceled with ctx. It stands in for context.WithoutCancel of
+// Go 1.21.
+func withoutCancel(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
+
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
@@ -10,13 +10,22 @@ import (
 	"github.com/lesnoi-kot/versions-backend/common"
 	"github.com/lesnoi-kot/versions-backend/mongostore"
 	"github.com/lesnoi-kot/versions-backend/mq"
+	"github.com/lesnoi-kot/versions-backend/tracing"
 )
 
 type AppConfig struct {
 	Debug        bool     `env:"DEBUG" envDefault:"true"`
 	MongoURI     string   `env:"MONGO_URI,notEmpty"`
-	RabbitURI    string   `env:"RABBIT_URI,notEmpty"`
+	QueueBackend string   `env:"QUEUE_BACKEND" envDefault:"rabbitmq"`
+	RabbitURI    string   `env:"RABBIT_URI"`
+	NatsURI      string   `env:"NATS_URI"`
 	AllowOrigins []string `env:"ALLOW_ORIGINS" envDefault:"*"`
+	GRPCAddress  string   `env:"GRPC_ADDRESS" envDefault:":4001"`
+	GithubToken  string   `env:"GITHUB_TOKEN"`
+
+	// Spans are exported if the endpoint is set. The exporter reads the rest
+	// of OTEL_EXPORTER_OTLP_* variables itself.
+	OTLPEndpoint string `env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
 }
 
 func main() {
@@ -29,6 +38,12 @@ func main() {
 	defer cancel()
 	go common.HandleInterruptSignal(cancel)
 
+	shutdownTracing, err := tracing.Init(globalCtx, "versions-api", config.OTLPEndpoint != "")
+	if err != nil {
+		log.Fatalf("Tracing setup error: %s", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	store, err := mongostore.ConnectStore(globalCtx, config.MongoURI)
 	if err != nil {
 		log.Fatalf("Mongo connection error: %s", err)
@@ -37,20 +52,45 @@ func main() {
 	log.Println("Mongo connection established")
 	defer store.Disconnect(globalCtx)
 
-	amqp, err := mq.NewAMQPConnection(config.RabbitURI)
+	queueURI := config.RabbitURI
+	if config.QueueBackend == mq.BackendNATS {
+		queueURI = config.NatsURI
+	}
+
+	queue, err := mq.NewQueue(config.QueueBackend, queueURI)
 	if err != nil {
-		log.Fatalf("RabbitMQ connection error: %s", err)
+		log.Fatalf("Queue connection error: %s", err)
 	}
 
-	log.Println("RabbitMQ connection established")
-	defer amqp.Close()
+	log.Println("Queue connection established")
+	defer queue.Close()
 
-	apiService := api.NewAPI(api.APIConfig{
+	apiService, err := api.NewAPI(api.APIConfig{
 		Store:        store,
-		MQ:           amqp,
+		MQ:           queue,
 		AllowOrigins: config.AllowOrigins,
 		Debug:        config.Debug,
+		GithubToken:  config.GithubToken,
 	})
+	if err != nil {
+		log.Fatalf("API setup error: %s", err)
+	}
+
+	apiService.StartOutboxRelay()
+	apiService.StartImportReclaimer()
+
+	go func() {
+		if err := apiService.StartGRPC(config.GRPCAddress); err != nil {
+			log.Printf("gRPC server stopped with an error: %s", err)
+		}
+	}()
+
+	go func() {
+		<-globalCtx.Done()
+		if err := apiService.Shutdown(); err != nil {
+			log.Printf("API shutdown error: %s", err)
+		}
+	}()
 
 	if err := apiService.Start(":4000"); err != nil {
 		log.Println("API service is stopped")
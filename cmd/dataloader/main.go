@@ -2,23 +2,43 @@ package main
 
 import (
 	"context"
+	"net/http"
 	"runtime"
 	"sync"
+	"time"
 
 	"github.com/caarlos0/env/v6"
 	"github.com/rs/zerolog/log"
 
 	"github.com/lesnoi-kot/versions-backend/common"
 	"github.com/lesnoi-kot/versions-backend/dataloader"
+	"github.com/lesnoi-kot/versions-backend/metrics"
 	"github.com/lesnoi-kot/versions-backend/mongostore"
 	"github.com/lesnoi-kot/versions-backend/mq"
+	"github.com/lesnoi-kot/versions-backend/tracing"
 )
 
 type AppConfig struct {
-	MongoURI  string `env:"MONGO_URI,notEmpty"`
-	RabbitURI string `env:"RABBIT_URI,notEmpty"`
+	MongoURI        string        `env:"MONGO_URI,notEmpty"`
+	QueueBackend    string        `env:"QUEUE_BACKEND" envDefault:"rabbitmq"`
+	RabbitURI       string        `env:"RABBIT_URI"`
+	NatsURI         string        `env:"NATS_URI"`
+	SourceRetention time.Duration `env:"SOURCE_RETENTION" envDefault:"720h"`
+	HealthAddress   string        `env:"HEALTH_ADDRESS" envDefault:":4002"` // Serves health and /metrics.
+
+	// Tokens are listed in the variable or in the file, one per line. The file
+	// is reloaded when it changes.
+	GithubTokens     []string `env:"GITHUB_TOKENS"`
+	GithubTokensFile string   `env:"GITHUB_TOKENS_FILE"`
+	GithubToken      string   `env:"GITHUB_GQL_OAUTH_TOKEN"`
+
+	// Spans are exported if the endpoint is set. The exporter reads the rest
+	// of OTEL_EXPORTER_OTLP_* variables itself.
+	OTLPEndpoint string `env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
 }
 
+const githubTokensReloadInterval = 30 * time.Second
+
 func main() {
 	config := new(AppConfig)
 	if err := env.Parse(config); err != nil {
@@ -29,6 +49,12 @@ func main() {
 	defer cancel()
 	go common.HandleInterruptSignal(cancel)
 
+	shutdownTracing, err := tracing.Init(globalCtx, "versions-dataloader", config.OTLPEndpoint != "")
+	if err != nil {
+		log.Fatal().Err(err).Msg("Tracing setup error")
+	}
+	defer shutdownTracing(context.Background())
+
 	store, err := mongostore.ConnectStore(globalCtx, config.MongoURI)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Mongo connection error")
@@ -37,19 +63,55 @@ func main() {
 	log.Info().Msg("Mongo connection established")
 	defer store.Disconnect(globalCtx)
 
-	amqp, err := mq.NewAMQPConnection(config.RabbitURI)
+	queueURI := config.RabbitURI
+	if config.QueueBackend == mq.BackendNATS {
+		queueURI = config.NatsURI
+	}
+
+	queue, err := mq.NewQueue(config.QueueBackend, queueURI)
 	if err != nil {
-		log.Fatal().Err(err).Msg("RabbitMQ connection error")
+		log.Fatal().Err(err).Msg("Queue connection error")
 	}
 
-	log.Info().Msg("RabbitMQ connection established")
-	defer amqp.Close()
+	log.Info().Msg("Queue connection established")
+	defer queue.Close()
+
+	githubTokens := config.GithubTokens
+	if config.GithubToken != "" {
+		githubTokens = append(githubTokens, config.GithubToken)
+	}
+
+	tokens, err := dataloader.NewTokenPool(githubTokens, config.GithubTokensFile)
+	if err != nil {
+		log.Fatal().Err(err).Msg("GitHub tokens loading error")
+	}
+
+	tokens.Governor = dataloader.NewGovernor(store)
+	go tokens.Watch(globalCtx, githubTokensReloadInterval)
 
 	dataloader := &dataloader.Dataloader{
-		MQ:    amqp,
-		Store: store,
+		MQ:              queue,
+		Store:           store,
+		Tokens:          tokens,
+		SourceRetention: config.SourceRetention,
 	}
 
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/", dataloader.HealthHandler())
+
+	healthServer := &http.Server{Addr: config.HealthAddress, Handler: mux}
+	go func() {
+		if err := healthServer.ListenAndServe(); err != http.ErrServerClosed {
+			log.Error().Err(err).Msg("Health server stopped with an error")
+		}
+	}()
+	defer healthServer.Close()
+
+	go dataloader.PurgeDeletedSources(globalCtx)
+	go dataloader.ReapExpiredLeases(globalCtx)
+	go dataloader.RelayEvents(globalCtx)
+
 	var wg sync.WaitGroup
 	wg.Add(runtime.NumCPU())
 
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/caarlos0/env/v6"
+	"github.com/lesnoi-kot/versions-backend/mq"
+)
+
+type AppConfig struct {
+	QueueBackend string `env:"QUEUE_BACKEND" envDefault:"rabbitmq"`
+	RabbitURI    string `env:"RABBIT_URI"`
+	NatsURI      string `env:"NATS_URI"`
+}
+
+// Number of parked messages searched by inspect unless told otherwise, so
+// a long parking lot is not read into memory.
+const inspectLimit = 1000
+
+const usage = `Usage: mqadmin <command> [arguments]
+
+Commands of the parking lot of repo requests:
+  list [-limit N]             list parked messages
+  inspect [-limit N] <id>     print a parked message with its headers
+  replay <id> | -all          push parked messages back to their queues
+  purge <id> | -all           remove parked messages
+`
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	config := new(AppConfig)
+	if err := env.Parse(config); err != nil {
+		log.Fatalf("Config parsing error: %s", err)
+	}
+
+	queueURI := config.RabbitURI
+	if config.QueueBackend == mq.BackendNATS {
+		queueURI = config.NatsURI
+	}
+
+	parkingLot, err := mq.NewParkingLot(config.QueueBackend, queueURI)
+	if err != nil {
+		log.Fatalf("Queue connection error: %s", err)
+	}
+
+	defer parkingLot.Close()
+
+	command, args := flag.Arg(0), flag.Args()[1:]
+
+	switch command {
+	case "list":
+		flags := flag.NewFlagSet("list", flag.ExitOnError)
+		limit := flags.Int("limit", 100, "maximum number of messages")
+		flags.Parse(args)
+
+		parked, err := parkingLot.ListParkedRequests(*limit)
+		if err != nil {
+			log.Fatalf("Parked messages listing error: %s", err)
+		}
+
+		for _, msg := range parked {
+			fmt.Printf("%s\t%s\t%s\t%s\n", msg.ID, msg.ParkedAt.Format("2006-01-02 15:04:05"), msg.Queue, msg.Reason)
+		}
+
+	case "inspect":
+		flags := flag.NewFlagSet("inspect", flag.ExitOnError)
+		limit := flags.Int("limit", inspectLimit, "maximum number of messages to search")
+		flags.Parse(args)
+
+		id := messageID(flags.Args())
+
+		parked, err := parkingLot.ListParkedRequests(*limit)
+		if err != nil {
+			log.Fatalf("Parked messages listing error: %s", err)
+		}
+
+		for _, msg := range parked {
+			if msg.ID == id {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				encoder.Encode(msg)
+				return
+			}
+		}
+
+		log.Fatalf("Parked message %s is not found among the first %d messages", id, *limit)
+
+	case "replay", "purge":
+		flags := flag.NewFlagSet(command, flag.ExitOnError)
+		all := flags.Bool("all", false, "take every parked message")
+		flags.Parse(args)
+
+		match := func(*mq.ParkedMessage) bool { return true }
+		if !*all {
+			id := messageID(flags.Args())
+			match = func(msg *mq.ParkedMessage) bool { return msg.ID == id }
+		}
+
+		var count int
+		if command == "replay" {
+			count, err = parkingLot.ReplayParkedRequests(context.Background(), match)
+		} else {
+			count, err = parkingLot.PurgeParkedRequests(match)
+		}
+		if err != nil {
+			log.Fatalf("Parked messages %s error: %s", command, err)
+		}
+
+		fmt.Printf("%d messages taken\n", count)
+
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func messageID(args []string) string {
+	if len(args) != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	return args[0]
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/caarlos0/env/v6"
+	"github.com/rs/zerolog/log"
+
+	"github.com/lesnoi-kot/versions-backend/api"
+	"github.com/lesnoi-kot/versions-backend/common"
+	"github.com/lesnoi-kot/versions-backend/dataloader"
+	"github.com/lesnoi-kot/versions-backend/mongostore"
+	"github.com/lesnoi-kot/versions-backend/mq"
+	"github.com/lesnoi-kot/versions-backend/tracing"
+)
+
+// AppConfig combines settings of the API and the dataloader. Requests are
+// queued in the process, so only Mongo is needed.
+type AppConfig struct {
+	Debug           bool          `env:"DEBUG" envDefault:"true"`
+	MongoURI        string        `env:"MONGO_URI,notEmpty"`
+	AllowOrigins    []string      `env:"ALLOW_ORIGINS" envDefault:"*"`
+	GRPCAddress     string        `env:"GRPC_ADDRESS" envDefault:":4001"`
+	GithubToken     string        `env:"GITHUB_TOKEN"`
+	SourceRetention time.Duration `env:"SOURCE_RETENTION" envDefault:"720h"`
+
+	// Tokens of the dataloader are listed in the variable or in the file, one
+	// per line. The file is reloaded when it changes.
+	GithubTokens     []string `env:"GITHUB_TOKENS"`
+	GithubTokensFile string   `env:"GITHUB_TOKENS_FILE"`
+	GithubGQLToken   string   `env:"GITHUB_GQL_OAUTH_TOKEN"`
+
+	// Spans are exported if the endpoint is set. The exporter reads the rest
+	// of OTEL_EXPORTER_OTLP_* variables itself.
+	OTLPEndpoint string `env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+}
+
+const githubTokensReloadInterval = 30 * time.Second
+
+func main() {
+	config := new(AppConfig)
+	if err := env.Parse(config); err != nil {
+		log.Fatal().Err(err).Msg("Config parsing error")
+	}
+
+	globalCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go common.HandleInterruptSignal(cancel)
+
+	shutdownTracing, err := tracing.Init(globalCtx, "versions", config.OTLPEndpoint != "")
+	if err != nil {
+		log.Fatal().Err(err).Msg("Tracing setup error")
+	}
+	defer shutdownTracing(context.Background())
+
+	store, err := mongostore.ConnectStore(globalCtx, config.MongoURI)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Mongo connection error")
+	}
+
+	log.Info().Msg("Mongo connection established")
+	defer store.Disconnect(context.Background())
+
+	// Requests left in the queue on exit are lost. Their sources are fetched
+	// again on the next refresh or once their fetch leases expire.
+	queue := mq.NewMemoryQueue()
+	defer queue.Close()
+
+	githubTokens := config.GithubTokens
+	if config.GithubGQLToken != "" {
+		githubTokens = append(githubTokens, config.GithubGQLToken)
+	}
+
+	tokens, err := dataloader.NewTokenPool(githubTokens, config.GithubTokensFile)
+	if err != nil {
+		log.Fatal().Err(err).Msg("GitHub tokens loading error")
+	}
+
+	tokens.Governor = dataloader.NewGovernor(store)
+	go tokens.Watch(globalCtx, githubTokensReloadInterval)
+
+	loader := &dataloader.Dataloader{
+		MQ:              queue,
+		Store:           store,
+		Tokens:          tokens,
+		SourceRetention: config.SourceRetention,
+	}
+
+	go loader.PurgeDeletedSources(globalCtx)
+	go loader.ReapExpiredLeases(globalCtx)
+	go loader.RelayEvents(globalCtx)
+
+	var wg sync.WaitGroup
+	wg.Add(runtime.NumCPU())
+
+	for i := 0; i < runtime.NumCPU(); i++ {
+		go func() {
+			if err := loader.Serve(globalCtx); err != nil {
+				log.Error().Err(err).Msg("dataloader.Serve error")
+			}
+
+			wg.Done()
+		}()
+	}
+
+	apiService, err := api.NewAPI(api.APIConfig{
+		Store:        store,
+		MQ:           queue,
+		AllowOrigins: config.AllowOrigins,
+		Debug:        config.Debug,
+		GithubToken:  config.GithubToken,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("API setup error")
+	}
+
+	apiService.StartOutboxRelay()
+	apiService.StartImportReclaimer()
+
+	go func() {
+		if err := apiService.StartGRPC(config.GRPCAddress); err != nil {
+			log.Error().Err(err).Msg("gRPC server stopped with an error")
+		}
+	}()
+
+	go func() {
+		<-globalCtx.Done()
+		if err := apiService.Shutdown(); err != nil {
+			log.Error().Err(err).Msg("API shutdown error")
+		}
+	}()
+
+	if err := apiService.Start(":4000"); err != http.ErrServerClosed {
+		log.Error().Err(err).Msg("Server stopped with an error")
+	}
+
+	log.Info().Msg("API service is stopped, waiting for dataloader workers")
+	cancel()
+	wg.Wait()
+}
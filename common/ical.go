@@ -0,0 +1,124 @@
+package common
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	icalProductID     = "-//lesnoi-kot//versions-backend//EN"
+	icalMaxLineOctets = 75
+	icalDateFormat    = "20060102"
+	icalTimeFormat    = "20060102T150405Z"
+)
+
+type ICalEvent struct {
+	UID         string
+	Summary     string
+	Description string
+	URL         string
+	Date        time.Time
+	Stamp       time.Time
+}
+
+type ICalendar struct {
+	Name   string
+	Events []ICalEvent
+}
+
+// WriteTo encodes the calendar as an RFC 5545 stream of all-day VEVENTs.
+func (cal *ICalendar) WriteTo(w io.Writer) (int64, error) {
+	iw := &icalWriter{w: bufio.NewWriter(w)}
+
+	iw.line("BEGIN", "VCALENDAR")
+	iw.line("VERSION", "2.0")
+	iw.line("PRODID", icalProductID)
+	iw.line("CALSCALE", "GREGORIAN")
+	iw.line("METHOD", "PUBLISH")
+	if cal.Name != "" {
+		iw.line("X-WR-CALNAME", escapeICalText(cal.Name))
+	}
+
+	for _, event := range cal.Events {
+		date := event.Date.UTC()
+
+		iw.line("BEGIN", "VEVENT")
+		iw.line("UID", escapeICalText(event.UID))
+		iw.line("DTSTAMP", event.Stamp.UTC().Format(icalTimeFormat))
+		iw.line("DTSTART;VALUE=DATE", date.Format(icalDateFormat))
+		iw.line("DTEND;VALUE=DATE", date.AddDate(0, 0, 1).Format(icalDateFormat))
+		iw.line("SUMMARY", escapeICalText(event.Summary))
+		if event.Description != "" {
+			iw.line("DESCRIPTION", escapeICalText(event.Description))
+		}
+		if event.URL != "" {
+			iw.line("URL", event.URL)
+		}
+		iw.line("TRANSP", "TRANSPARENT")
+		iw.line("END", "VEVENT")
+	}
+
+	iw.line("END", "VCALENDAR")
+
+	if iw.err == nil {
+		iw.err = iw.w.Flush()
+	}
+
+	return iw.n, iw.err
+}
+
+type icalWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+// line writes a content line, folding it at 75 octets without splitting
+// multi-byte characters.
+func (iw *icalWriter) line(name, value string) {
+	if iw.err != nil {
+		return
+	}
+
+	content := name + ":" + value
+	limit := icalMaxLineOctets
+
+	for len(content) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+
+		iw.write(content[:cut] + "\r\n ")
+		content = content[cut:]
+		limit = icalMaxLineOctets - 1 // Continuation lines start with a space.
+	}
+
+	iw.write(content + "\r\n")
+}
+
+func (iw *icalWriter) write(s string) {
+	if iw.err != nil {
+		return
+	}
+
+	n, err := iw.w.WriteString(s)
+	iw.n += int64(n)
+	iw.err = err
+}
+
+var icalTextEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+	"\r", "",
+)
+
+func escapeICalText(text string) string {
+	return icalTextEscaper.Replace(text)
+}
@@ -0,0 +1,81 @@
+package common_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lesnoi-kot/versions-backend/common"
+)
+
+func TestICalendarWriteTo(t *testing.T) {
+	publishedAt := time.Date(2023, 7, 4, 15, 30, 0, 0, time.UTC)
+	cal := &common.ICalendar{
+		Name: "lesnoi-kot/karten-backend",
+		Events: []common.ICalEvent{
+			{
+				UID:         "RE_kwDOJ@versions",
+				Summary:     "lesnoi-kot/karten-backend v1.0.0",
+				Description: "First release; stable, finally\nEnjoy",
+				URL:         "https://github.com/lesnoi-kot/karten-backend/releases/tag/v1.0.0",
+				Date:        publishedAt,
+				Stamp:       publishedAt,
+			},
+		},
+	}
+
+	var sb strings.Builder
+	n, err := cal.WriteTo(&sb)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	out := sb.String()
+	if int(n) != len(out) {
+		t.Errorf("Written bytes count mismatch: %d != %d", n, len(out))
+	}
+
+	expectedLines := []string{
+		"BEGIN:VCALENDAR",
+		"UID:RE_kwDOJ@versions",
+		"DTSTAMP:20230704T153000Z",
+		"DTSTART;VALUE=DATE:20230704",
+		"DTEND;VALUE=DATE:20230705",
+		`DESCRIPTION:First release\; stable\, finally\nEnjoy`,
+		"END:VCALENDAR",
+	}
+
+	for _, line := range expectedLines {
+		if !strings.Contains(out, line+"\r\n") {
+			t.Errorf("Expected line %q in output:\n%s", line, out)
+		}
+	}
+}
+
+func TestICalendarLineFolding(t *testing.T) {
+	cal := &common.ICalendar{
+		Events: []common.ICalEvent{
+			{UID: "x", Summary: strings.Repeat("абв", 60)},
+		},
+	}
+
+	var sb strings.Builder
+	if _, err := cal.WriteTo(&sb); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	for _, line := range strings.Split(sb.String(), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("Line is longer than 75 octets: %q", line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("Line contains a split character: %q", line)
+		}
+	}
+
+	unfolded := strings.ReplaceAll(sb.String(), "\r\n ", "")
+	if !strings.Contains(unfolded, "SUMMARY:"+strings.Repeat("абв", 60)+"\r\n") {
+		t.Error("Unfolded summary does not match the original one")
+	}
+}
@@ -3,76 +3,380 @@ package dataloader
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
 
+	"github.com/lesnoi-kot/versions-backend/metrics"
 	"github.com/lesnoi-kot/versions-backend/mongostore"
 	"github.com/lesnoi-kot/versions-backend/mq"
-	"github.com/rabbitmq/amqp091-go"
+	"github.com/lesnoi-kot/versions-backend/tracing"
 	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	purgeInterval = 1 * time.Hour
+
+	// consumeRetryDelay is the pause before consuming again after the queue
+	// channel is closed.
+	consumeRetryDelay = 1 * time.Second
+
+	// minRateLimitRetryDelay is used when the reset of the GitHub budget is
+	// unknown or passed.
+	minRateLimitRetryDelay = 1 * time.Minute
+
+	// maxRetries is the number of retries of a failed message before giving up.
+	maxRetries = 10
+
+	// Number of interactive requests handled per background one when both
+	// lanes have messages.
+	interactiveWeight = 4
+)
+
+var (
+	errTooManyRetries    = errors.New("Gave up after too many retries")
+	errFetchLeaseExpired = errors.New("Fetch lease expired")
+	errDeliveriesClosed  = errors.New("Queue deliveries channel is closed")
 )
 
 type Dataloader struct {
-	MQ    *mq.AMQPConnection
-	Store *mongostore.Store
+	MQ     mq.Queue
+	Store  *mongostore.Store
+	Tokens *TokenPool
+
+	// Deleted sources are kept for this period to be restorable.
+	SourceRetention time.Duration
 }
 
+// Serve handles repo requests until the context is done. Consuming is resumed
+// once the queue connection is restored.
 func (dataloader Dataloader) Serve(ctx context.Context) error {
-	ch, err := dataloader.MQ.Channel()
+	for {
+		err := dataloader.consume(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		log.Error().Err(err).Msg("Queue consuming stopped, waiting for queue connection")
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(consumeRetryDelay):
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-dataloader.MQ.Connected():
+		}
+	}
+}
+
+func (dataloader Dataloader) consume(ctx context.Context) error {
+	// Consumers are stopped once consuming of any lane stops.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	interactive, err := dataloader.MQ.Consume(ctx, mq.LaneInteractive)
 	if err != nil {
 		return err
 	}
 
-	defer ch.Close()
-
-	msgs, err := mq.ConsumeRepoRequestsQueue(ch)
+	background, err := dataloader.MQ.Consume(ctx, mq.LaneBackground)
 	if err != nil {
 		return err
 	}
 
-	log.Info().Msg("Queue channel initialized. Ready to handle messages")
+	log.Info().Msg("Queue consumers initialized. Ready to handle messages")
 
-	for {
-		select {
-		case <-ctx.Done():
+	for handled := 0; ; handled++ {
+		// Background requests are preferred once in a while, so they are not
+		// starved by interactive ones.
+		preferred, other := interactive, background
+		if handled%(interactiveWeight+1) == interactiveWeight {
+			preferred, other = background, interactive
+		}
+
+		msg, ok := nextDelivery(ctx, preferred, other)
+		if ctx.Err() != nil {
 			return nil
-		case msg := <-msgs:
-			dataloader.handleMessage(ctx, &msg)
+		} else if !ok {
+			return errDeliveriesClosed
 		}
+
+		dataloader.handleMessage(ctx, msg)
 	}
 }
 
-func (dataloader Dataloader) handleMessage(ctx context.Context, msg *amqp091.Delivery) {
-	if deathCount := mq.GetDeliveryDeathCount(msg); deathCount > 10 {
-		log.Info().Msgf("Discarding message with x-death count > 10")
-		msg.Ack(false)
-		return
+// nextDelivery takes a waiting message of the preferred lane, otherwise the
+// first message of any lane.
+func nextDelivery(ctx context.Context, preferred, other <-chan mq.Delivery) (mq.Delivery, bool) {
+	select {
+	case msg, ok := <-preferred:
+		return msg, ok
+	default:
 	}
 
+	select {
+	case <-ctx.Done():
+		return nil, false
+	case msg, ok := <-preferred:
+		return msg, ok
+	case msg, ok := <-other:
+		return msg, ok
+	}
+}
+
+func (dataloader Dataloader) handleMessage(ctx context.Context, msg mq.Delivery) {
+	metrics.MessagesConsumed.WithLabelValues(string(msg.Lane())).Inc()
+
+	// The handling continues the trace of the request producer.
+	ctx, span := tracing.Tracer().Start(
+		msg.Context(ctx),
+		msg.Lane().QueueName()+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.destination.name", msg.Lane().QueueName()),
+			attribute.String("messaging.message.id", msg.MessageID()),
+			attribute.Int("messaging.retries", msg.Retries()),
+		),
+	)
+	defer span.End()
+
 	body := new(mq.GithubRepoRequestMessage)
 
-	if err := json.Unmarshal(msg.Body, body); err != nil {
-		log.Error().Err(err).Msgf(`Invalid RabbitMQ message body: "%s"`, string(msg.Body))
-		msg.Ack(false)
+	if err := json.Unmarshal(msg.Body(), body); err != nil {
+		log.Error().Err(err).Msgf(`Invalid queue message body: "%s"`, string(msg.Body()))
+		dataloader.settle(msg, metrics.OutcomeParked, msg.Park(ctx, fmt.Sprintf("invalid message body: %s", err)))
+		return
+	}
+
+	if body.DeduplicationID == "" {
+		body.DeduplicationID = msg.MessageID()
+	}
+
+	if dataloader.isHandled(ctx, body.DeduplicationID) {
+		log.Info().Str("deduplicationId", body.DeduplicationID).Msg("Message is already handled, discarding it")
+		dataloader.settle(msg, metrics.OutcomeAcked, msg.Ack())
+		return
+	}
+
+	// Messages pushed before jobs were tracked do not have a job.
+	jobID, _ := primitive.ObjectIDFromHex(body.JobID)
+
+	if msg.Retries() > maxRetries {
+		log.Info().Msgf("Parking message retried more than %d times", maxRetries)
+		dataloader.releaseQueuedLease(ctx, body.SourceID)
+		dataloader.finishJob(ctx, jobID, mongostore.JobStatusFailed, errTooManyRetries)
+		dataloader.settle(msg, metrics.OutcomeParked, msg.Park(ctx, errTooManyRetries.Error()))
 		return
 	}
 
+	dataloader.updateJob(jobID, func() error {
+		return dataloader.Store.StartJob(ctx, jobID)
+	})
+
 	loader := NewGithubReleaseLoader(GithubReleaseLoaderConfig{
 		MongoStore: dataloader.Store,
+		Tokens:     dataloader.Tokens,
 		Message:    body,
 	})
 
 	err := loader.Dispatch(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
 
 	if err == nil {
 		log.Info().Msg("Message successfully dispatched")
-		msg.Ack(false)
+		dataloader.finishJob(ctx, jobID, mongostore.JobStatusSucceeded, nil)
+		dataloader.markHandled(ctx, body.DeduplicationID)
+		dataloader.settle(msg, metrics.OutcomeAcked, msg.Ack())
 	} else if err == context.Canceled {
 		log.Info().Msgf("Message handling process is canceled")
-		msg.Nack(false, true)
-	} else if err == ErrRateLimit {
-		log.Info().Msgf(`Rate limit error encountered, retry current message later`)
-		msg.Reject(false) // Send to retry queue
+		// The service context is canceled, so the job is requeued without it.
+		dataloader.finishJob(context.Background(), jobID, mongostore.JobStatusQueued, nil)
+		dataloader.settle(msg, metrics.OutcomeRequeued, msg.Requeue())
+	} else if err == ErrSourceDeleted {
+		log.Info().Msg("Source is deleted, discarding the message")
+		dataloader.finishJob(ctx, jobID, mongostore.JobStatusFailed, err)
+		dataloader.markHandled(ctx, body.DeduplicationID)
+		dataloader.settle(msg, metrics.OutcomeAcked, msg.Ack())
+	} else if err == mongostore.ErrFetchLeaseHeld || err == mongostore.ErrFetchLeaseLost {
+		log.Info().Err(err).Msg("Source is fetched by another loader, discarding the message")
+		dataloader.finishJob(ctx, jobID, mongostore.JobStatusFailed, err)
+		dataloader.markHandled(ctx, body.DeduplicationID)
+		dataloader.settle(msg, metrics.OutcomeAcked, msg.Ack())
+	} else if errors.Is(err, ErrRateLimit) {
+		dataloader.finishJob(ctx, jobID, mongostore.JobStatusRateLimited, err)
+		dataloader.retryAtReset(ctx, msg)
+	} else if isRetryable(err) {
+		log.Warn().Err(err).Msg(`Github release loader failed, retry current message later`)
+		dataloader.finishJob(ctx, jobID, mongostore.JobStatusQueued, err)
+		dataloader.settle(msg, metrics.OutcomeRetried, msg.Retry(ctx))
 	} else {
 		log.Error().Err(err).Msg(`Github release loader failed`)
-		msg.Ack(false)
+		dataloader.finishJob(ctx, jobID, mongostore.JobStatusFailed, err)
+		dataloader.markHandled(ctx, body.DeduplicationID)
+		dataloader.settle(msg, metrics.OutcomeAcked, msg.Ack())
 	}
 }
+
+// retryAtReset delays the message until the GitHub budget is reset.
+func (dataloader Dataloader) retryAtReset(ctx context.Context, msg mq.Delivery) {
+	delay := time.Until(dataloader.Tokens.ResetAt(ctx))
+	if delay < minRateLimitRetryDelay {
+		delay = minRateLimitRetryDelay
+	}
+
+	log.Info().Msgf("Rate limit error encountered, retry current message in %s", delay.Round(time.Second))
+	dataloader.settle(msg, metrics.OutcomeDelayed, msg.Delay(ctx, delay))
+}
+
+// releaseQueuedLease drops the queued fetch lease kept for the retries of a
+// message which is given up.
+func (dataloader Dataloader) releaseQueuedLease(ctx context.Context, sourceID string) {
+	id, err := primitive.ObjectIDFromHex(sourceID)
+	if err != nil {
+		return
+	}
+
+	if err := dataloader.Store.ReleaseFetchLease(ctx, id, "", false); err != nil {
+		log.Error().Err(err).Str("source", sourceID).Msg("Queued fetch lease release error")
+	}
+}
+
+// settle counts the outcome of the message and logs a failure to settle it.
+// The queue redelivers or dead letters such messages.
+func (dataloader Dataloader) settle(msg mq.Delivery, outcome string, err error) {
+	if err != nil {
+		log.Error().Err(err).Msg("Message settling error")
+		outcome = metrics.OutcomeFailed
+	}
+
+	metrics.MessagesSettled.WithLabelValues(string(msg.Lane()), outcome).Inc()
+}
+
+// isHandled tells whether a message with the deduplication ID was handled.
+// Messages are handled again if it can not be checked.
+func (dataloader Dataloader) isHandled(ctx context.Context, deduplicationID string) bool {
+	if deduplicationID == "" {
+		return false
+	}
+
+	handled, err := dataloader.Store.IsMessageHandled(ctx, deduplicationID)
+	if err != nil {
+		log.Error().Err(err).Msg("Handled messages lookup error")
+	}
+
+	return handled
+}
+
+func (dataloader Dataloader) markHandled(ctx context.Context, deduplicationID string) {
+	if deduplicationID == "" {
+		return
+	}
+
+	if err := dataloader.Store.MarkMessageHandled(ctx, deduplicationID); err != nil {
+		log.Error().Err(err).Msg("Handled message saving error")
+	}
+}
+
+func (dataloader Dataloader) finishJob(ctx context.Context, jobID primitive.ObjectID, status string, jobErr error) {
+	dataloader.updateJob(jobID, func() error {
+		return dataloader.Store.FinishJob(ctx, jobID, status, jobErr)
+	})
+}
+
+// updateJob applies the update to the job if the message has one. Failures are
+// only logged since the job status is informational.
+func (dataloader Dataloader) updateJob(jobID primitive.ObjectID, update func() error) {
+	if jobID.IsZero() {
+		return
+	}
+
+	if err := update(); err != nil {
+		log.Error().Err(err).Str("job", jobID.Hex()).Msg("Job update error")
+	}
+}
+
+// PurgeDeletedSources periodically removes sources deleted earlier than the
+// retention period.
+func (dataloader Dataloader) PurgeDeletedSources(ctx context.Context) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		count, err := dataloader.Store.PurgeDeletedSources(ctx, time.Now().Add(-dataloader.SourceRetention))
+		if err != nil {
+			log.Error().Err(err).Msg("Deleted sources purge failed")
+		} else if count > 0 {
+			log.Info().Msgf("Purged %d deleted sources", count)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ReapExpiredLeases periodically queues again fetches of sources whose leases
+// expired, e.g. because their dataloader crashed.
+func (dataloader Dataloader) ReapExpiredLeases(ctx context.Context) {
+	ticker := time.NewTicker(mongostore.FetchLeaseTTL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			source, err := dataloader.Store.ReclaimExpiredFetchLease(ctx)
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				break
+			} else if err != nil {
+				log.Error().Err(err).Msg("Expired fetch leases reclaiming failed")
+				break
+			}
+
+			log.Info().Str("source", source.ID.Hex()).Msg("Fetch lease expired, queueing the source again")
+			if err := dataloader.requeue(ctx, source); err != nil {
+				log.Error().Err(err).Str("source", source.ID.Hex()).Msg("Source requeueing failed")
+			}
+		}
+	}
+}
+
+// requeue pushes a fetch request for the source reusing its unfinished job.
+func (dataloader Dataloader) requeue(ctx context.Context, source *mongostore.Source) error {
+	job, err := dataloader.Store.GetActiveJob(ctx, source.ID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		job, err = dataloader.Store.CreateJob(ctx, source.ID)
+	} else if err == nil {
+		err = dataloader.Store.FinishJob(ctx, job.ID, mongostore.JobStatusQueued, errFetchLeaseExpired)
+	}
+	if err != nil {
+		return err
+	}
+
+	return dataloader.MQ.PushRepoRequest(ctx, mq.LaneBackground, &mq.GithubRepoRequestMessage{
+		Owner:    source.Owner,
+		Repo:     source.Name,
+		SourceID: source.ID.Hex(),
+		JobID:    job.ID.Hex(),
+
+		DeduplicationID: primitive.NewObjectID().Hex(),
+	})
+}
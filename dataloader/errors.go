@@ -0,0 +1,29 @@
+package dataloader
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// errGithubUnavailable is returned for server errors of GitHub API.
+var errGithubUnavailable = errors.New("GitHub API is unavailable")
+
+// isRetryable tells whether the error is transient, so the request may
+// succeed later. Other errors, e.g. a missing repository, are permanent.
+func isRetryable(err error) bool {
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, errGithubUnavailable),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr),
+		mongo.IsNetworkError(err),
+		mongo.IsTimeout(err):
+		return true
+	}
+
+	return false
+}
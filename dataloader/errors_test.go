@@ -0,0 +1,34 @@
+package dataloader_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/lesnoi-kot/versions-backend/dataloader"
+)
+
+func TestIsRetryable(t *testing.T) {
+	type testCase struct {
+		err       error
+		retryable bool
+	}
+
+	testCases := []testCase{
+		{&url.Error{Op: "Post", URL: "https://api.github.com/graphql", Err: errors.New("connection reset")}, true},
+		{fmt.Errorf("%w: 502 Bad Gateway", dataloader.ErrGithubUnavailable), true},
+		{context.DeadlineExceeded, true},
+		{errors.New("Could not resolve to a Repository"), false},
+		{dataloader.ErrSourceDeleted, false},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.err.Error(), func(t *testing.T) {
+			if retryable := dataloader.IsRetryable(test.err); retryable != test.retryable {
+				t.Errorf("isRetryable(%q) = %v, expected %v", test.err, retryable, test.retryable)
+			}
+		})
+	}
+}
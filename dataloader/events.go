@@ -0,0 +1,77 @@
+package dataloader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lesnoi-kot/versions-backend/mq"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	eventsPollInterval = 1 * time.Second
+
+	// eventLock is how long a claimed event is not relayed by others.
+	eventLock = 30 * time.Second
+
+	// eventPublishTimeout leaves time to mark the event published before its
+	// claim expires.
+	eventPublishTimeout = eventLock / 2
+)
+
+// RelayEvents publishes pending domain events until the context is done.
+func (dataloader Dataloader) RelayEvents(ctx context.Context) {
+	ticker := time.NewTicker(eventsPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			err := dataloader.relayEvent(ctx)
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				break
+			} else if err != nil {
+				if ctx.Err() == nil {
+					log.Error().Err(err).Msg("Event relaying error")
+				}
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// relayEvent publishes the oldest pending event and marks it published once
+// the broker confirms it. Publishing is bounded by the claim, so other relays
+// do not take the event meanwhile.
+//
+// The confirm and the mark can not be made atomic: if the relay stops or
+// marking fails after the broker confirmed the event, it is published again
+// with the same ID. See "Publishing once" in the README for the contract.
+func (dataloader Dataloader) relayEvent(ctx context.Context) error {
+	pending, err := dataloader.Store.ClaimPendingEvent(ctx, eventLock)
+	if err != nil {
+		return err
+	}
+
+	event := new(mq.Event)
+	if err := json.Unmarshal(pending.Body, event); err != nil {
+		return err
+	}
+
+	publishCtx, cancel := context.WithTimeout(ctx, eventPublishTimeout)
+	defer cancel()
+
+	if err := dataloader.MQ.PublishEvent(publishCtx, event); err != nil {
+		return err
+	}
+
+	return dataloader.Store.MarkEventPublished(ctx, pending)
+}
@@ -0,0 +1,7 @@
+package dataloader
+
+// Unexported helpers used by tests of the dataloader_test package.
+var (
+	IsRetryable          = isRetryable
+	ErrGithubUnavailable = errGithubUnavailable
+)
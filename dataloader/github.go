@@ -2,18 +2,23 @@ package dataloader
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"sync/atomic"
 	"time"
 
+	"github.com/lesnoi-kot/versions-backend/metrics"
 	"github.com/lesnoi-kot/versions-backend/mongostore"
 	"github.com/lesnoi-kot/versions-backend/mq"
 	"github.com/shurcooL/githubv4"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"golang.org/x/oauth2"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -21,20 +26,34 @@ import (
 
 const requestReleasesPerPage = 50
 
-var ErrRateLimit = errors.New("Reached GitHub API rate limits")
+var (
+	ErrRateLimit     = errors.New("Reached GitHub API rate limits")
+	ErrSourceDeleted = errors.New("Source is deleted")
+)
+
+// hostname identifies owners of fetch leases in logs.
+var hostname, _ = os.Hostname()
 
 type GithubReleaseLoaderConfig struct {
 	MongoStore *mongostore.Store
+	Tokens     *TokenPool
 	Message    *mq.GithubRepoRequestMessage
 }
 
 type GithubReleaseLoader struct {
 	ghClient *githubv4.Client
+	tokens   *TokenPool
 	store    *mongostore.Store
 	repoInfo queryBriefRepo
+	sourceID primitive.ObjectID
+	jobID    primitive.ObjectID
 	owner    string
 	repo     string
 	logger   zerolog.Logger
+
+	storeInfo  *repoInfoFromStore
+	leaseOwner string
+	leaseLost  atomic.Bool
 }
 
 type repoInfoFromStore struct {
@@ -46,11 +65,19 @@ type repoInfoFromStore struct {
 type releaseFetcher func(ctx context.Context, afterRelease *string) ([]*mongostore.Release, string, error)
 
 func NewGithubReleaseLoader(config GithubReleaseLoaderConfig) *GithubReleaseLoader {
+	// Messages pushed before source IDs were added are matched by external ID.
+	sourceID, _ := primitive.ObjectIDFromHex(config.Message.SourceID)
+	jobID, _ := primitive.ObjectIDFromHex(config.Message.JobID)
+
 	return &GithubReleaseLoader{
-		ghClient: nil,
-		store:    config.MongoStore,
-		owner:    config.Message.Owner,
-		repo:     config.Message.Repo,
+		ghClient:   nil,
+		tokens:     config.Tokens,
+		store:      config.MongoStore,
+		sourceID:   sourceID,
+		jobID:      jobID,
+		leaseOwner: fmt.Sprintf("%s/%s", hostname, primitive.NewObjectID().Hex()),
+		owner:      config.Message.Owner,
+		repo:       config.Message.Repo,
 		logger: log.
 			With().
 			Str("owner", config.Message.Owner).
@@ -63,12 +90,82 @@ func NewGithubReleaseLoader(config GithubReleaseLoaderConfig) *GithubReleaseLoad
 func (loader *GithubReleaseLoader) Dispatch(ctx context.Context) error {
 	loader.logger.Info().Msg("Message dispatch started")
 
-	authorizedHTTPClient := oauth2.NewClient(
-		context.Background(),
-		oauth2.StaticTokenSource(&oauth2.Token{AccessToken: os.Getenv("GITHUB_GQL_OAUTH_TOKEN")}),
-	)
-	loader.ghClient = githubv4.NewClient(authorizedHTTPClient)
+	loader.ghClient = githubv4.NewClient(&http.Client{Transport: otelhttp.NewTransport(loader.tokens)})
+
+	if loader.sourceID.IsZero() {
+		if err := loader.loadRepoInfo(ctx); err != nil {
+			return err
+		}
+	} else {
+		// Skip deleted sources before spending GitHub rate limits on them.
+		_, err := loader.getRepoFromStore(ctx, bson.D{{"_id", loader.sourceID}, {"deleted_at", nil}})
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrSourceDeleted
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if err := loader.store.AcquireFetchLease(ctx, loader.sourceID, loader.leaseOwner); err != nil {
+		return err
+	}
+
+	fetchCtx, cancelFetch := context.WithCancel(ctx)
+	defer cancelFetch()
+	go loader.renewLease(fetchCtx, cancelFetch)
+
+	loader.emit(ctx, &mongostore.SourceEvent{Type: mongostore.EventFetchStarted})
 
+	err := loader.fetch(fetchCtx)
+	cancelFetch()
+
+	if loader.leaseLost.Load() {
+		err = mongostore.ErrFetchLeaseLost
+	}
+
+	// Rate limited and transiently failed fetches are retried later, so the
+	// source stays queued.
+	requeue := errors.Is(err, ErrRateLimit) || isRetryable(err)
+	if err := loader.store.ReleaseFetchLease(ctx, loader.sourceID, loader.leaseOwner, requeue); err != nil {
+		loader.logger.Error().Err(err).Msg("Fetch lease release error")
+	}
+
+	finished := &mongostore.SourceEvent{Type: mongostore.EventFetchFinished}
+	if err != nil {
+		finished.Error = err.Error()
+	}
+	loader.emit(ctx, finished)
+
+	return err
+}
+
+// renewLease extends the fetch lease until the context is done. The fetch is
+// canceled if another owner took the lease.
+func (loader *GithubReleaseLoader) renewLease(ctx context.Context, cancelFetch context.CancelFunc) {
+	ticker := time.NewTicker(mongostore.FetchLeaseTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := loader.store.RenewFetchLease(ctx, loader.sourceID, loader.leaseOwner)
+		if errors.Is(err, mongostore.ErrFetchLeaseLost) {
+			loader.logger.Error().Msg("Fetch lease is lost, canceling the fetch")
+			loader.leaseLost.Store(true)
+			cancelFetch()
+			return
+		} else if err != nil && ctx.Err() == nil {
+			loader.logger.Error().Err(err).Msg("Fetch lease renewal error")
+		}
+	}
+}
+
+// loadRepoInfo looks up the repository on GitHub and its source.
+func (loader *GithubReleaseLoader) loadRepoInfo(ctx context.Context) error {
 	err := loader.ghClient.Query(ctx, &loader.repoInfo, map[string]any{
 		"owner": githubv4.String(loader.owner),
 		"name":  githubv4.String(loader.repo),
@@ -78,27 +175,34 @@ func (loader *GithubReleaseLoader) Dispatch(ctx context.Context) error {
 	}
 
 	externalID := fmt.Sprintf("github/%d", loader.repoInfo.Repository.DatabaseId)
-	mongoRepoInfo, err := loader.getRepoFromStore(ctx, bson.D{{"external_id", externalID}})
-	if err != nil {
+	loader.storeInfo, err = loader.getRepoFromStore(ctx, bson.D{{"external_id", externalID}, {"deleted_at", nil}})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrSourceDeleted
+	} else if err != nil {
 		return err
 	}
 
-	defer func() {
-		loader.store.
-			Database(mongostore.DatabaseName).
-			Collection(mongostore.SourcesCollectionName).
-			UpdateOne(
-				ctx,
-				bson.D{{"external_id", externalID}},
-				bson.D{{"$set", bson.D{{"is_fetching", false}}}},
-			)
-	}()
+	loader.sourceID = loader.storeInfo.ID
+	return nil
+}
 
-	releases, endCursor, err := loader.loadReleasesOrTags(ctx, mongoRepoInfo.EndCursor)
+func (loader *GithubReleaseLoader) fetch(ctx context.Context) error {
+	if loader.storeInfo == nil {
+		if err := loader.loadRepoInfo(ctx); err != nil {
+			return err
+		}
+	}
 
-	if err != nil && len(releases) == 0 {
-		loader.logger.Error().Err(err).Msgf("Releases loading error: %s", err)
-		return err
+	releases, endCursor, loadErr := loader.loadReleasesOrTags(ctx, loader.storeInfo.EndCursor)
+
+	if loadErr != nil && len(releases) == 0 {
+		loader.logger.Error().Err(loadErr).Msgf("Releases loading error: %s", loadErr)
+		return loadErr
+	}
+
+	// Fetched releases are saved before the retry of a rate limited fetch.
+	if !errors.Is(loadErr, ErrRateLimit) {
+		loadErr = nil
 	}
 
 	if len(releases) == 0 {
@@ -108,32 +212,132 @@ func (loader *GithubReleaseLoader) Dispatch(ctx context.Context) error {
 
 	loader.logger.Info().Msgf("UpdateOne, ready to push %d new items", len(releases))
 
-	updateResult, err := loader.store.
-		Database(mongostore.DatabaseName).
-		Collection(mongostore.SourcesCollectionName).
-		UpdateOne(
-			ctx,
-			bson.D{
-				{"external_id", externalID},
-				{"end_cursor", mongoRepoInfo.EndCursor},
-			},
-			bson.D{
-				{"$set", bson.D{
-					{"end_cursor", endCursor},
-					{"is_fetching", false},
-				}},
-				{"$push", bson.D{{"releases", bson.D{
-					{"$each", releases},
-					{"$sort", bson.D{{"published_at", 1}}},
-				}}}},
-			},
-		)
+	committed, err := loader.saveReleases(ctx, releases, endCursor)
+	if err != nil {
+		return err
+	}
 
-	if updateResult.ModifiedCount == 0 {
+	if !committed {
 		loader.logger.Info().Msg("Update was not commited")
+		return loadErr
 	}
 
-	return err
+	events := make([]*mongostore.SourceEvent, 0, len(releases))
+	for _, release := range releases {
+		events = append(events, &mongostore.SourceEvent{
+			Type:    mongostore.EventReleaseAdded,
+			Release: release,
+		})
+	}
+	loader.emit(ctx, events...)
+
+	return loadErr
+}
+
+// saveReleases pushes new releases to the source along with domain events
+// announcing them in the same transaction. It returns false if the source was
+// changed by someone else meanwhile.
+func (loader *GithubReleaseLoader) saveReleases(ctx context.Context, releases []*mongostore.Release, endCursor *string) (bool, error) {
+	pendingEvents, err := loader.domainEvents(releases, endCursor)
+	if err != nil {
+		return false, err
+	}
+
+	sess, err := loader.store.StartSession()
+	if err != nil {
+		return false, err
+	}
+	defer sess.EndSession(ctx)
+
+	committed, err := sess.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		updateResult, err := loader.store.
+			Database(mongostore.DatabaseName).
+			Collection(mongostore.SourcesCollectionName).
+			UpdateOne(
+				sessCtx,
+				bson.D{
+					{"_id", loader.sourceID},
+					{"end_cursor", loader.storeInfo.EndCursor},
+					{"deleted_at", nil},
+					{"fetch_lease.owner", loader.leaseOwner},
+				},
+				bson.D{
+					{"$set", bson.D{
+						{"end_cursor", endCursor},
+					}},
+					{"$push", bson.D{{"releases", bson.D{
+						{"$each", releases},
+						{"$sort", bson.D{{"published_at", 1}}},
+					}}}},
+				},
+			)
+		if err != nil {
+			return false, err
+		}
+
+		if updateResult.ModifiedCount == 0 {
+			return false, nil
+		}
+
+		return true, loader.store.AddPendingEvents(sessCtx, pendingEvents...)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return committed.(bool), nil
+}
+
+// domainEvents makes release.created events of the releases and a
+// source.updated event of the source.
+func (loader *GithubReleaseLoader) domainEvents(releases []*mongostore.Release, endCursor *string) ([]*mongostore.PendingEvent, error) {
+	source := mq.EventSource{
+		ID:    loader.sourceID.Hex(),
+		Owner: loader.owner,
+		Repo:  loader.repo,
+	}
+
+	events := make([]*mq.Event, 0, len(releases)+1)
+	for _, release := range releases {
+		events = append(events, mq.NewReleaseCreatedEvent(source, mq.EventRelease{
+			ID:          release.ID,
+			Name:        release.Name,
+			TagName:     release.TagName,
+			URL:         release.URL,
+			PublishedAt: release.PublishedAt,
+			IsSemver:    release.IsSemver,
+		}))
+	}
+
+	var cursor string
+	if endCursor != nil {
+		cursor = *endCursor
+	}
+	events = append(events, mq.NewSourceUpdatedEvent(source, cursor, len(releases)))
+
+	pendingEvents := make([]*mongostore.PendingEvent, 0, len(events))
+	for _, event := range events {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return nil, err
+		}
+
+		pendingEvents = append(pendingEvents, &mongostore.PendingEvent{ID: event.ID, Body: body})
+	}
+
+	return pendingEvents, nil
+}
+
+// emit stores source events for subscribers. Failures are only logged since
+// events are informational.
+func (loader *GithubReleaseLoader) emit(ctx context.Context, events ...*mongostore.SourceEvent) {
+	for _, event := range events {
+		event.SourceID = loader.sourceID
+	}
+
+	if err := loader.store.AddSourceEvents(ctx, events...); err != nil {
+		loader.logger.Error().Err(err).Msg("Source events saving error")
+	}
 }
 
 func (loader *GithubReleaseLoader) loadReleasesOrTags(ctx context.Context, afterCursor *string) ([]*mongostore.Release, *string, error) {
@@ -152,10 +356,9 @@ func (loader *GithubReleaseLoader) loadReleasesOrTags(ctx context.Context, after
 
 	allReleases := []*mongostore.Release{}
 	currCursor := afterCursor
+	pagesFetched := 0
 
 	for {
-		time.Sleep(1 * time.Second)
-
 		releases, endCursor, err := fetch(ctx, currCursor)
 		if err != nil {
 			return allReleases, currCursor, err
@@ -174,8 +377,25 @@ func (loader *GithubReleaseLoader) loadReleasesOrTags(ctx context.Context, after
 		}
 
 		currCursor = &endCursor
+
+		pagesFetched++
+		loader.emit(ctx, &mongostore.SourceEvent{
+			Type: mongostore.EventFetchProgress,
+			Progress: &mongostore.FetchProgress{
+				PagesFetched:    pagesFetched,
+				ReleasesFetched: len(allReleases),
+			},
+		})
+
+		if !loader.jobID.IsZero() {
+			if err := loader.store.SetJobProgress(ctx, loader.jobID, pagesFetched, len(allReleases)); err != nil {
+				loader.logger.Error().Err(err).Msg("Job progress saving error")
+			}
+		}
 	}
 
+	metrics.JobPagesFetched.Observe(float64(pagesFetched))
+
 	return allReleases, currCursor, nil
 }
 
@@ -197,7 +417,9 @@ func (loader *GithubReleaseLoader) loadReleases(ctx context.Context, afterCursor
 			Direction: "ASC",
 		},
 	})
-	if err != nil {
+	if errors.Is(err, ErrRateLimit) {
+		return nil, "", ErrRateLimit
+	} else if err != nil {
 		return nil, "", err
 	}
 
@@ -213,7 +435,7 @@ func (loader *GithubReleaseLoader) loadReleases(ctx context.Context, afterCursor
 		})
 	}
 
-	if githubReleasesInfo.RateLimit.Remaining == 0 {
+	if loader.isRateLimited(githubReleasesInfo.RateLimit) {
 		err = ErrRateLimit
 	}
 
@@ -238,7 +460,9 @@ func (loader *GithubReleaseLoader) loadTags(ctx context.Context, afterCursor *st
 			Direction: "ASC",
 		},
 	})
-	if err != nil {
+	if errors.Is(err, ErrRateLimit) {
+		return nil, "", ErrRateLimit
+	} else if err != nil {
 		return nil, "", err
 	}
 
@@ -254,13 +478,27 @@ func (loader *GithubReleaseLoader) loadTags(ctx context.Context, afterCursor *st
 		})
 	}
 
-	if githubTagsInfo.RateLimit.Remaining == 0 {
+	if loader.isRateLimited(githubTagsInfo.RateLimit) {
 		err = ErrRateLimit
 	}
 
 	return tags, string(githubTagsInfo.Repository.Refs.PageInfo.EndCursor), err
 }
 
+// isRateLimited tells whether the token of the query and the rest of the pool
+// ran out of budget.
+func (loader *GithubReleaseLoader) isRateLimited(limit rateLimit) bool {
+	loader.logger.Debug().
+		Int("cost", int(limit.Cost)).
+		Int("remaining", int(limit.Remaining)).
+		Time("resetAt", limit.ResetAt.Time).
+		Msg("GitHub rate limit")
+
+	metrics.GithubQueryCost.Add(float64(limit.Cost))
+
+	return limit.Remaining == 0 && !loader.tokens.HasBudget()
+}
+
 func (loader *GithubReleaseLoader) getRepoFromStore(ctx context.Context, filter bson.D) (*repoInfoFromStore, error) {
 	source := new(repoInfoFromStore)
 	err := loader.store.
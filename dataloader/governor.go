@@ -0,0 +1,111 @@
+package dataloader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/lesnoi-kot/versions-backend/mongostore"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// maxGithubRequestWait is the longest wait for a request slot. Longer
+	// waits fail with ErrRateLimit, so the message is retried at the budget
+	// reset.
+	maxGithubRequestWait = 1 * time.Minute
+
+	// fallbackGithubRequestInterval paces requests of the process while the
+	// store is unavailable. It keeps even a single token below the GitHub
+	// limit of 5000 requests per hour.
+	fallbackGithubRequestInterval = 1 * time.Second
+)
+
+// Governor paces GitHub requests of every dataloader sharing the store, so
+// the budget of a token lasts until its reset.
+type Governor struct {
+	Store *mongostore.Store
+
+	fallback *rate.Limiter
+}
+
+func NewGovernor(store *mongostore.Store) *Governor {
+	return &Governor{
+		Store:    store,
+		fallback: rate.NewLimiter(rate.Every(fallbackGithubRequestInterval), 1),
+	}
+}
+
+// Wait blocks until the next request slot of the token.
+func (governor *Governor) Wait(ctx context.Context, token string) error {
+	wait, err := governor.reserve(ctx, token)
+	if err != nil {
+		return err
+	} else if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// reserve takes the next request slot of the token and returns the wait for
+// it. Requests are paced locally at the fallback interval if the store is
+// unavailable.
+func (governor *Governor) reserve(ctx context.Context, token string) (time.Duration, error) {
+	slot, err := governor.Store.ReserveGithubRequest(ctx, tokenID(token))
+	if err == nil {
+		wait := time.Until(slot)
+		if wait > maxGithubRequestWait {
+			return 0, ErrRateLimit
+		}
+
+		return wait, nil
+	} else if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	log.Error().Err(err).Msg("GitHub request slot reservation error, pacing requests locally")
+
+	reservation := governor.fallback.Reserve()
+	wait := reservation.Delay()
+	if wait > maxGithubRequestWait {
+		reservation.Cancel()
+		return 0, ErrRateLimit
+	}
+
+	return wait, nil
+}
+
+// ResetAt is the earliest budget reset of the tokens shared by dataloaders. It
+// is zero if no budget is known.
+func (governor *Governor) ResetAt(ctx context.Context, tokens []string) (time.Time, error) {
+	ids := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		ids = append(ids, tokenID(token))
+	}
+
+	return governor.Store.GetGithubResetAt(ctx, ids)
+}
+
+// Observe shares the budget of the token reported by GitHub.
+func (governor *Governor) Observe(ctx context.Context, token string, remaining int, resetAt time.Time) {
+	if err := governor.Store.SaveGithubRateLimit(ctx, tokenID(token), remaining, resetAt); err != nil {
+		log.Error().Err(err).Msg("GitHub rate limit saving error")
+	}
+}
+
+// tokenID identifies a token in the store without revealing it.
+func tokenID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
@@ -2,7 +2,16 @@ package dataloader
 
 import "github.com/shurcooL/githubv4"
 
+// rateLimit is the budget of the token used for a query.
+type rateLimit struct {
+	Cost      githubv4.Int
+	Remaining githubv4.Int
+	ResetAt   githubv4.DateTime
+}
+
 type queryBriefRepo struct {
+	RateLimit rateLimit
+
 	Repository struct {
 		ID         githubv4.ID
 		DatabaseId githubv4.Int
@@ -18,9 +27,7 @@ type queryBriefRepo struct {
 }
 
 type queryReleases struct {
-	RateLimit struct {
-		Remaining githubv4.Int
-	}
+	RateLimit rateLimit
 
 	Repository struct {
 		ID githubv4.ID
@@ -45,9 +52,7 @@ type queryReleases struct {
 }
 
 type queryTags struct {
-	RateLimit struct {
-		Remaining githubv4.Int
-	}
+	RateLimit rateLimit
 
 	Repository struct {
 		ID githubv4.ID
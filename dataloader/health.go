@@ -0,0 +1,20 @@
+package dataloader
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/lesnoi-kot/versions-backend/health"
+)
+
+// HealthHandler reports whether Mongo and the queue are reachable. It responds
+// with 503 while any of them is down.
+func (dataloader Dataloader) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := health.Check(r.Context(), dataloader.Store, dataloader.MQ)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(report.Status())
+		json.NewEncoder(w).Encode(report)
+	})
+}
@@ -0,0 +1,293 @@
+package dataloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lesnoi-kot/versions-backend/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrNoGithubTokens = errors.New("GitHub token pool is empty")
+
+// TokenPool authorizes GitHub requests with the token which has the most
+// remaining rate limit budget. Tokens of the file are reloaded when it changes.
+type TokenPool struct {
+	// Governor paces requests of the tokens if set.
+	Governor *Governor
+
+	mu     sync.Mutex
+	tokens []*githubToken
+
+	static      []string
+	file        string
+	fileModTime time.Time
+	transport   http.RoundTripper
+}
+
+type githubToken struct {
+	value     string
+	remaining int
+	resetAt   time.Time
+}
+
+func NewTokenPool(tokens []string, file string) (*TokenPool, error) {
+	pool := &TokenPool{
+		static:    tokens,
+		file:      file,
+		transport: http.DefaultTransport,
+	}
+
+	if err := pool.reload(); err != nil {
+		return nil, err
+	}
+	if len(pool.tokens) == 0 {
+		return nil, ErrNoGithubTokens
+	}
+
+	return pool, nil
+}
+
+// Watch reloads the tokens file every interval until the context is done.
+func (pool *TokenPool) Watch(ctx context.Context, interval time.Duration) {
+	if pool.file == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := pool.reload(); err != nil {
+			log.Error().Err(err).Msg("GitHub tokens reloading error")
+		}
+	}
+}
+
+func (pool *TokenPool) reload() error {
+	values := append([]string{}, pool.static...)
+
+	if pool.file != "" {
+		info, err := os.Stat(pool.file)
+		if err != nil {
+			return err
+		}
+
+		pool.mu.Lock()
+		unchanged := info.ModTime().Equal(pool.fileModTime)
+		pool.mu.Unlock()
+		if unchanged {
+			return nil
+		}
+
+		data, err := os.ReadFile(pool.file)
+		if err != nil {
+			return err
+		}
+
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				values = append(values, line)
+			}
+		}
+
+		pool.mu.Lock()
+		pool.fileModTime = info.ModTime()
+		pool.mu.Unlock()
+	}
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	// Accounting of the tokens which are kept is not reset.
+	known := make(map[string]*githubToken, len(pool.tokens))
+	for _, token := range pool.tokens {
+		known[token.value] = token
+	}
+
+	tokens := make([]*githubToken, 0, len(values))
+	for _, value := range values {
+		if token, ok := known[value]; ok {
+			tokens = append(tokens, token)
+		} else {
+			tokens = append(tokens, &githubToken{value: value, remaining: -1})
+		}
+	}
+
+	if len(pool.tokens) > 0 && len(tokens) != len(pool.tokens) {
+		log.Info().Msgf("GitHub token pool is reloaded with %d tokens", len(tokens))
+	}
+
+	pool.tokens = tokens
+	return nil
+}
+
+// pick takes the token with the most remaining budget and reserves a request.
+// Tokens without known budget or with a passed reset time are tried first.
+func (pool *TokenPool) pick() (*githubToken, error) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	var picked *githubToken
+	best := -1
+
+	for _, token := range pool.tokens {
+		if budget := token.budget(); budget > best {
+			picked, best = token, budget
+		}
+	}
+
+	if picked == nil {
+		return nil, ErrNoGithubTokens
+	}
+
+	if picked.remaining > 0 {
+		picked.remaining--
+	}
+
+	return picked, nil
+}
+
+// HasBudget tells whether any token has remaining budget.
+func (pool *TokenPool) HasBudget() bool {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	for _, token := range pool.tokens {
+		if token.budget() > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ResetAt is the earliest reset of the token budgets. The budgets shared by the
+// governor are preferred to the ones seen by the pool. It is zero if no budget
+// is known.
+func (pool *TokenPool) ResetAt(ctx context.Context) time.Time {
+	if pool.Governor != nil {
+		resetAt, err := pool.Governor.ResetAt(ctx, pool.values())
+		if err == nil && !resetAt.IsZero() {
+			return resetAt
+		} else if err != nil {
+			log.Error().Err(err).Msg("GitHub budget reset lookup error")
+		}
+	}
+
+	return pool.localResetAt()
+}
+
+func (pool *TokenPool) localResetAt() time.Time {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	var resetAt time.Time
+	for _, token := range pool.tokens {
+		if !token.resetAt.IsZero() && (resetAt.IsZero() || token.resetAt.Before(resetAt)) {
+			resetAt = token.resetAt
+		}
+	}
+
+	return resetAt
+}
+
+func (pool *TokenPool) values() []string {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	values := make([]string, 0, len(pool.tokens))
+	for _, token := range pool.tokens {
+		values = append(values, token.value)
+	}
+
+	return values
+}
+
+// budget is the remaining number of requests, unknown budget is unlimited.
+func (token *githubToken) budget() int {
+	if token.remaining < 0 || time.Now().After(token.resetAt) {
+		return math.MaxInt
+	}
+
+	return token.remaining
+}
+
+func (pool *TokenPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := pool.pick()
+	if err != nil {
+		closeBody(req)
+		return nil, err
+	}
+
+	if pool.Governor != nil {
+		if err := pool.Governor.Wait(req.Context(), token.value); err != nil {
+			closeBody(req)
+			return nil, err
+		}
+	}
+
+	authorized := req.Clone(req.Context())
+	authorized.Header.Set("Authorization", "Bearer "+token.value)
+
+	res, err := pool.transport.RoundTrip(authorized)
+	if err != nil {
+		metrics.GithubRequests.WithLabelValues("error").Inc()
+		return nil, err
+	}
+
+	metrics.GithubRequests.WithLabelValues(strconv.Itoa(res.StatusCode)).Inc()
+
+	pool.observe(req.Context(), token, res.Header)
+
+	if res.StatusCode >= http.StatusInternalServerError {
+		res.Body.Close()
+		return nil, fmt.Errorf("%w: %s", errGithubUnavailable, res.Status)
+	}
+
+	return res, nil
+}
+
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// observe saves the rate limit of the token reported by GitHub.
+func (pool *TokenPool) observe(ctx context.Context, token *githubToken, header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+
+	reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	pool.mu.Lock()
+	token.remaining = remaining
+	token.resetAt = time.Unix(reset, 0)
+	pool.mu.Unlock()
+
+	metrics.GithubRateLimitRemaining.WithLabelValues(tokenID(token.value)).Set(float64(remaining))
+
+	if pool.Governor != nil {
+		pool.Governor.Observe(ctx, token.value, remaining, time.Unix(reset, 0))
+	}
+}
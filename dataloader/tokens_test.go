@@ -0,0 +1,63 @@
+package dataloader_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lesnoi-kot/versions-backend/dataloader"
+)
+
+func TestTokenPool(t *testing.T) {
+	remaining := map[string]int{"Bearer a": 10, "Bearer b": 100}
+	reset := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	var used []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("Authorization")
+		used = append(used, token)
+		remaining[token]--
+
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining[token]))
+		w.Header().Set("X-RateLimit-Reset", reset)
+	}))
+	defer server.Close()
+
+	pool, err := dataloader.NewTokenPool([]string{"a", "b"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{Transport: pool}
+	for i := 0; i < 4; i++ {
+		res, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+
+	// Both tokens are tried once, then the one with the most budget is used.
+	if used[2] != "Bearer b" || used[3] != "Bearer b" {
+		t.Errorf("Token with the most budget is not picked: %v", used)
+	}
+
+	if !pool.HasBudget() {
+		t.Errorf("Pool has no budget")
+	}
+}
+
+func TestTokenPoolEmpty(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tokens")
+	if err := os.WriteFile(file, []byte("# no tokens\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dataloader.NewTokenPool(nil, file); err != dataloader.ErrNoGithubTokens {
+		t.Errorf("Expected ErrNoGithubTokens, got %v", err)
+	}
+}
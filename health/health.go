@@ -0,0 +1,52 @@
+// Package health checks the dependencies shared by the API and the dataloader.
+// Each binary serves the report in its own way.
+package health
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/lesnoi-kot/versions-backend/mongostore"
+	"github.com/lesnoi-kot/versions-backend/mq"
+)
+
+const (
+	checkTimeout = 2 * time.Second
+
+	Up   = "up"
+	Down = "down"
+)
+
+// Report tells whether each dependency is reachable.
+type Report struct {
+	Mongo string `json:"mongo"`
+	Queue string `json:"queue"`
+}
+
+// Check pings Mongo and looks up the queue connection.
+func Check(ctx context.Context, store *mongostore.Store, queue mq.Queue) Report {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	report := Report{Mongo: Up, Queue: Up}
+
+	if err := store.Ping(ctx, nil); err != nil {
+		report.Mongo = Down
+	}
+
+	if !queue.IsConnected() {
+		report.Queue = Down
+	}
+
+	return report
+}
+
+// Status is 200 if every dependency is up and 503 otherwise.
+func (report Report) Status() int {
+	if report.Mongo != Up || report.Queue != Up {
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusOK
+}
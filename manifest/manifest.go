@@ -0,0 +1,181 @@
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"golang.org/x/mod/modfile"
+)
+
+type Ecosystem string
+
+const (
+	Go    Ecosystem = "go"
+	NPM   Ecosystem = "npm"
+	PyPI  Ecosystem = "pypi"
+	Cargo Ecosystem = "cargo"
+)
+
+var ErrUnsupportedManifest = errors.New("unsupported manifest file")
+
+// Dependency is a direct dependency declared in a manifest. Version is kept
+// as declared, e.g. "^1.2.0" or ">=2.0,<3".
+type Dependency struct {
+	Name      string    `json:"name"`
+	Version   string    `json:"version"`
+	Ecosystem Ecosystem `json:"ecosystem"`
+}
+
+// Parse detects the manifest kind by its file name and returns its direct
+// dependencies sorted by name.
+func Parse(filename string, data []byte) (Ecosystem, []Dependency, error) {
+	var (
+		ecosystem Ecosystem
+		deps      []Dependency
+		err       error
+	)
+
+	switch name := path.Base(filename); {
+	case name == "go.mod":
+		ecosystem = Go
+		deps, err = parseGoMod(data)
+	case name == "package.json":
+		ecosystem = NPM
+		deps, err = parsePackageJSON(data)
+	case name == "Cargo.toml":
+		ecosystem = Cargo
+		deps, err = parseCargoToml(data)
+	case strings.HasPrefix(name, "requirements") && strings.HasSuffix(name, ".txt"):
+		ecosystem = PyPI
+		deps, err = parseRequirements(data)
+	default:
+		return "", nil, ErrUnsupportedManifest
+	}
+
+	if err != nil {
+		return "", nil, fmt.Errorf("%s parsing error: %w", filename, err)
+	}
+
+	for i := range deps {
+		deps[i].Ecosystem = ecosystem
+	}
+
+	sort.SliceStable(deps, func(i, j int) bool { return deps[i].Name < deps[j].Name })
+	return ecosystem, deps, nil
+}
+
+func parseGoMod(data []byte) ([]Dependency, error) {
+	file, err := modfile.ParseLax("go.mod", data, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	deps := make([]Dependency, 0, len(file.Require))
+	for _, req := range file.Require {
+		if req.Indirect {
+			continue
+		}
+
+		deps = append(deps, Dependency{Name: req.Mod.Path, Version: req.Mod.Version})
+	}
+
+	return deps, nil
+}
+
+func parsePackageJSON(data []byte) ([]Dependency, error) {
+	var pkg struct {
+		Dependencies    map[string]string `json:"dependencies"`
+		DevDependencies map[string]string `json:"devDependencies"`
+	}
+
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return nil, err
+	}
+
+	deps := []Dependency{}
+	for _, group := range []map[string]string{pkg.Dependencies, pkg.DevDependencies} {
+		for name, version := range group {
+			// Skip dependencies which do not come from the registry.
+			if strings.Contains(version, ":") || strings.Contains(version, "/") {
+				continue
+			}
+
+			deps = append(deps, Dependency{Name: name, Version: version})
+		}
+	}
+
+	return deps, nil
+}
+
+var requirementRegexp = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)(\[[^\]]*\])?\s*(.*)$`)
+
+func parseRequirements(data []byte) ([]Dependency, error) {
+	deps := []Dependency{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if i := strings.Index(line, ";"); i >= 0 {
+			line = line[:i] // Environment markers
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "-") || strings.Contains(line, "://") {
+			continue
+		}
+
+		matches := requirementRegexp.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+
+		deps = append(deps, Dependency{
+			Name:    strings.ToLower(matches[1]),
+			Version: strings.ReplaceAll(matches[3], " ", ""),
+		})
+	}
+
+	return deps, scanner.Err()
+}
+
+func parseCargoToml(data []byte) ([]Dependency, error) {
+	var cargo map[string]any
+	if err := toml.Unmarshal(data, &cargo); err != nil {
+		return nil, err
+	}
+
+	deps := []Dependency{}
+	for _, table := range []string{"dependencies", "dev-dependencies", "build-dependencies"} {
+		group, _ := cargo[table].(map[string]any)
+
+		for name, spec := range group {
+			switch spec := spec.(type) {
+			case string:
+				deps = append(deps, Dependency{Name: name, Version: spec})
+			case map[string]any:
+				version, ok := spec["version"].(string)
+				if !ok {
+					continue // Git or path dependency
+				}
+				if pkg, ok := spec["package"].(string); ok {
+					name = pkg
+				}
+
+				deps = append(deps, Dependency{Name: name, Version: version})
+			}
+		}
+	}
+
+	return deps, nil
+}
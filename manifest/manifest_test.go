@@ -0,0 +1,87 @@
+package manifest_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/lesnoi-kot/versions-backend/manifest"
+)
+
+func TestParse(t *testing.T) {
+	type testCase struct {
+		filename  string
+		content   string
+		ecosystem manifest.Ecosystem
+		deps      []manifest.Dependency
+	}
+
+	testCases := []testCase{
+		{
+			"go.mod",
+			"module x\n\ngo 1.19\n\nrequire (\n\tgithub.com/a/b v1.2.3\n\tgolang.org/x/mod v0.10.0 // indirect\n)\n",
+			manifest.Go,
+			[]manifest.Dependency{{"github.com/a/b", "v1.2.3", manifest.Go}},
+		},
+		{
+			"frontend/package.json",
+			`{"dependencies": {"react": "^18.2.0", "local": "file:../local"}, "devDependencies": {"vite": "~4.4.0"}}`,
+			manifest.NPM,
+			[]manifest.Dependency{{"react", "^18.2.0", manifest.NPM}, {"vite", "~4.4.0", manifest.NPM}},
+		},
+		{
+			"requirements-dev.txt",
+			"# tools\n-r requirements.txt\nDjango[argon2] >= 4.2 ; python_version > '3.8'\nrequests==2.31.0 # http\nhttps://example.com/pkg.zip\n",
+			manifest.PyPI,
+			[]manifest.Dependency{{"django", ">=4.2", manifest.PyPI}, {"requests", "==2.31.0", manifest.PyPI}},
+		},
+		{
+			"Cargo.toml",
+			"[dependencies]\nserde = \"1.0\"\ntokio = { version = \"1.29\", features = [\"full\"] }\nlocal = { path = \"../local\" }\n\n[dev-dependencies]\nrand_core = { package = \"rand\", version = \"0.8\" }\n",
+			manifest.Cargo,
+			[]manifest.Dependency{{"rand", "0.8", manifest.Cargo}, {"serde", "1.0", manifest.Cargo}, {"tokio", "1.29", manifest.Cargo}},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.filename, func(t *testing.T) {
+			ecosystem, deps, err := manifest.Parse(test.filename, []byte(test.content))
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if ecosystem != test.ecosystem {
+				t.Errorf("Ecosystem did not match: %s != %s", ecosystem, test.ecosystem)
+			}
+
+			if !reflect.DeepEqual(deps, test.deps) {
+				t.Errorf("Dependencies did not match:\n%v\n%v", deps, test.deps)
+			}
+		})
+	}
+
+	if _, _, err := manifest.Parse("pom.xml", nil); err != manifest.ErrUnsupportedManifest {
+		t.Errorf("Expected unsupported manifest error, got %v", err)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	latest := semver.MustParse("1.4.2")
+
+	testCases := map[string]manifest.Status{
+		"v1.4.2":                              manifest.StatusUpToDate,
+		"^1.2.0":                              manifest.StatusOutdated,
+		">=1.4.2,<2":                          manifest.StatusUpToDate,
+		"1.4":                                 manifest.StatusOutdated,
+		"v1.4.3-0.20230704064427-599ae7bbf27": manifest.StatusUpToDate,
+		"*":                                   manifest.StatusUnknown,
+	}
+
+	for declared, status := range testCases {
+		t.Run(declared, func(t *testing.T) {
+			if actual := manifest.CompareVersions(declared, latest); actual != status {
+				t.Errorf("Status did not match: %s != %s", actual, status)
+			}
+		})
+	}
+}
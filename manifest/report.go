@@ -0,0 +1,122 @@
+package manifest
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+type Status string
+
+const (
+	StatusUpToDate   Status = "up-to-date"
+	StatusOutdated   Status = "outdated"
+	StatusPending    Status = "pending"
+	StatusUnknown    Status = "unknown"
+	StatusUnresolved Status = "unresolved"
+)
+
+// Entry is a dependency compared against the latest release of its source.
+type Entry struct {
+	Dependency
+	Latest   string `json:"latest,omitempty"`
+	Status   Status `json:"status"`
+	SourceID string `json:"sourceId,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Note     string `json:"note,omitempty"`
+}
+
+type Report struct {
+	Manifest     string         `json:"manifest"`
+	Ecosystem    Ecosystem      `json:"ecosystem"`
+	GeneratedAt  time.Time      `json:"generatedAt"`
+	Summary      map[Status]int `json:"summary"`
+	Dependencies []Entry        `json:"dependencies"`
+}
+
+func NewReport(manifest string, ecosystem Ecosystem, entries []Entry) *Report {
+	report := &Report{
+		Manifest:     manifest,
+		Ecosystem:    ecosystem,
+		GeneratedAt:  time.Now().UTC(),
+		Summary:      make(map[Status]int),
+		Dependencies: entries,
+	}
+
+	for _, entry := range entries {
+		report.Summary[entry.Status]++
+	}
+
+	return report
+}
+
+var versionRegexp = regexp.MustCompile(`\d+(\.\d+){0,2}(-[0-9A-Za-z.-]+)?`)
+
+// CompareVersions compares the declared version of the dependency with the
+// latest released version. Range specifiers are compared by their lower
+// bound, e.g. "^1.2.0" or ">=1.2,<2" are treated as 1.2.0.
+func CompareVersions(declared string, latest *semver.Version) Status {
+	match := versionRegexp.FindString(declared)
+	if match == "" || latest == nil {
+		return StatusUnknown
+	}
+
+	current, err := semver.NewVersion(match)
+	if err != nil {
+		return StatusUnknown
+	}
+
+	if current.LessThan(latest) {
+		return StatusOutdated
+	}
+
+	return StatusUpToDate
+}
+
+func (report *Report) WriteMarkdown(w io.Writer) error {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "# Outdated dependencies of `%s`\n\n", report.Manifest)
+	fmt.Fprintf(&sb, "Generated at %s.\n\n", report.GeneratedAt.Format(time.RFC1123))
+
+	for _, status := range []Status{StatusOutdated, StatusUpToDate, StatusPending, StatusUnknown, StatusUnresolved} {
+		if count := report.Summary[status]; count > 0 {
+			fmt.Fprintf(&sb, "- **%s**: %d\n", status, count)
+		}
+	}
+
+	sb.WriteString("\n| Dependency | Current | Latest | Status |\n")
+	sb.WriteString("| --- | --- | --- | --- |\n")
+
+	for _, entry := range report.Dependencies {
+		name := escapeMarkdownCell(entry.Name)
+		if entry.URL != "" {
+			name = fmt.Sprintf("[%s](%s)", name, entry.URL)
+		}
+
+		status := string(entry.Status)
+		if entry.Note != "" {
+			status += " (" + escapeMarkdownCell(entry.Note) + ")"
+		}
+
+		fmt.Fprintf(
+			&sb,
+			"| %s | %s | %s | %s |\n",
+			name,
+			escapeMarkdownCell(entry.Version),
+			escapeMarkdownCell(entry.Latest),
+			status,
+		)
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func escapeMarkdownCell(text string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(text)
+}
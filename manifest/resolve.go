@@ -0,0 +1,211 @@
+package manifest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lesnoi-kot/versions-backend/common"
+	"golang.org/x/mod/module"
+)
+
+var ErrRepoNotFound = errors.New("github repository is not found")
+
+var githubRepoRegexp = regexp.MustCompile(`github\.com[/:]([a-zA-Z0-9-_]+)/([a-zA-Z0-9-_.]+)`)
+
+// Resolver maps dependencies to GitHub repositories using package registries.
+type Resolver struct {
+	Client *http.Client
+
+	// GoProxy is the module proxy resolving vanity import paths.
+	GoProxy string
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{
+		Client:  &http.Client{Timeout: 5 * time.Second},
+		GoProxy: "https://proxy.golang.org",
+	}
+}
+
+// ResolveGithubRepo returns a canonical https://github.com/owner/repo link of
+// the dependency's source repository.
+func (resolver *Resolver) ResolveGithubRepo(ctx context.Context, dep Dependency) (string, error) {
+	var (
+		candidate string
+		err       error
+	)
+
+	switch dep.Ecosystem {
+	case Go:
+		candidate, err = resolver.resolveGoModule(ctx, dep.Name)
+	case NPM:
+		candidate, err = resolver.resolveNPMPackage(ctx, dep.Name)
+	case PyPI:
+		candidate, err = resolver.resolvePyPIPackage(ctx, dep.Name)
+	case Cargo:
+		candidate, err = resolver.resolveCrate(ctx, dep.Name)
+	default:
+		return "", ErrRepoNotFound
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	matches := githubRepoRegexp.FindStringSubmatch(candidate)
+	if matches == nil {
+		return "", ErrRepoNotFound
+	}
+
+	owner, repo := matches[1], strings.TrimSuffix(matches[2], ".git")
+	link := fmt.Sprintf("https://github.com/%s/%s", owner, repo)
+
+	// Links are tracked only if they are accepted by the API as is.
+	if _, parsedRepo, err := common.ParseGithubRepoLink(link); err != nil || parsedRepo != repo {
+		return "", ErrRepoNotFound
+	}
+
+	return link, nil
+}
+
+func (resolver *Resolver) resolveGoModule(ctx context.Context, modulePath string) (string, error) {
+	if err := module.CheckPath(modulePath); err != nil {
+		return "", ErrRepoNotFound
+	}
+
+	if strings.HasPrefix(modulePath, "github.com/") {
+		return modulePath, nil
+	}
+
+	if strings.HasPrefix(modulePath, "golang.org/x/") {
+		name := strings.SplitN(strings.TrimPrefix(modulePath, "golang.org/x/"), "/", 2)[0]
+		return "github.com/golang/" + name, nil
+	}
+
+	// Module paths come from uploaded manifests, so their hosts are not
+	// requested. The proxy reports the repository of the latest version of
+	// vanity import paths instead.
+	escapedPath, err := module.EscapePath(modulePath)
+	if err != nil {
+		return "", ErrRepoNotFound
+	}
+
+	var info struct {
+		Origin *struct {
+			URL string `json:"URL"`
+		} `json:"Origin"`
+	}
+
+	if err := resolver.getJSON(ctx, resolver.GoProxy+"/"+escapedPath+"/@latest", &info); err != nil {
+		return "", err
+	}
+
+	if info.Origin == nil {
+		return "", ErrRepoNotFound
+	}
+
+	return info.Origin.URL, nil
+}
+
+func (resolver *Resolver) resolveNPMPackage(ctx context.Context, name string) (string, error) {
+	var pkg struct {
+		Repository json.RawMessage `json:"repository"`
+		Homepage   string          `json:"homepage"`
+	}
+
+	if err := resolver.getJSON(ctx, "https://registry.npmjs.org/"+url.PathEscape(name)+"/latest", &pkg); err != nil {
+		return "", err
+	}
+
+	// Repository is either a string or an object with the url field.
+	var repository struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal(pkg.Repository, &repository); err != nil {
+		json.Unmarshal(pkg.Repository, &repository.URL)
+	}
+
+	return repository.URL + " " + pkg.Homepage, nil
+}
+
+func (resolver *Resolver) resolvePyPIPackage(ctx context.Context, name string) (string, error) {
+	var pkg struct {
+		Info struct {
+			HomePage    string            `json:"home_page"`
+			ProjectURLs map[string]string `json:"project_urls"`
+		} `json:"info"`
+	}
+
+	if err := resolver.getJSON(ctx, "https://pypi.org/pypi/"+url.PathEscape(name)+"/json", &pkg); err != nil {
+		return "", err
+	}
+
+	for _, key := range []string{"Source", "Source Code", "Repository", "Code", "Homepage"} {
+		if link := pkg.Info.ProjectURLs[key]; githubRepoRegexp.MatchString(link) {
+			return link, nil
+		}
+	}
+	for _, link := range pkg.Info.ProjectURLs {
+		if githubRepoRegexp.MatchString(link) {
+			return link, nil
+		}
+	}
+
+	return pkg.Info.HomePage, nil
+}
+
+func (resolver *Resolver) resolveCrate(ctx context.Context, name string) (string, error) {
+	var crate struct {
+		Crate struct {
+			Repository string `json:"repository"`
+			Homepage   string `json:"homepage"`
+		} `json:"crate"`
+	}
+
+	if err := resolver.getJSON(ctx, "https://crates.io/api/v1/crates/"+url.PathEscape(name), &crate); err != nil {
+		return "", err
+	}
+
+	return crate.Crate.Repository + " " + crate.Crate.Homepage, nil
+}
+
+func (resolver *Resolver) getJSON(ctx context.Context, link string, v any) error {
+	body, err := resolver.get(ctx, link)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+func (resolver *Resolver) get(ctx context.Context, link string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// crates.io rejects requests without a user agent.
+	req.Header.Set("User-Agent", "versions-backend (https://github.com/lesnoi-kot/versions-backend)")
+
+	res, err := resolver.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone {
+		return nil, ErrRepoNotFound
+	} else if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded with %s", req.URL.Host, res.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(res.Body, 4<<20))
+}
@@ -0,0 +1,76 @@
+package manifest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/lesnoi-kot/versions-backend/manifest"
+)
+
+// proxyOnlyTransport fails requests to hosts other than the module proxy.
+type proxyOnlyTransport struct {
+	proxyHost string
+}
+
+func (transport proxyOnlyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != transport.proxyHost {
+		return nil, fmt.Errorf("unexpected request to %s", req.URL.Host)
+	}
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestResolveGoModule(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/go.uber.org/zap/@latest" {
+			fmt.Fprint(w, `{"Version":"v1.24.0","Origin":{"VCS":"git","URL":"https://github.com/uber-go/zap"}}`)
+			return
+		}
+
+		http.NotFound(w, r)
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	resolver := &manifest.Resolver{
+		Client:  &http.Client{Transport: proxyOnlyTransport{proxyURL.Host}},
+		GoProxy: proxy.URL,
+	}
+
+	type testCase struct {
+		module string
+		link   string
+		err    error
+	}
+
+	testCases := []testCase{
+		{"go.uber.org/zap", "https://github.com/uber-go/zap", nil},
+		{"github.com/a/b", "https://github.com/a/b", nil},
+		{"10.0.0.5:8080/x", "", manifest.ErrRepoNotFound},
+		{"localhost/x", "", manifest.ErrRepoNotFound},
+		{"169.254.169.254/latest/meta-data", "", manifest.ErrRepoNotFound},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.module, func(t *testing.T) {
+			link, err := resolver.ResolveGithubRepo(context.Background(), manifest.Dependency{
+				Name:      test.module,
+				Version:   "v1.0.0",
+				Ecosystem: manifest.Go,
+			})
+
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if link != test.link {
+				t.Errorf("Link did not match: %s != %s", link, test.link)
+			}
+		})
+	}
+}
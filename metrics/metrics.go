@@ -0,0 +1,96 @@
+// Package metrics defines Prometheus metrics of the API and the dataloader.
+// They are registered in the default registry served by Handler.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "versions"
+
+var (
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of HTTP requests by route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	GRPCRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "grpc",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of gRPC calls, or duration of streams, by method and code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "code"})
+
+	MessagesConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "dataloader",
+		Name:      "messages_consumed_total",
+		Help:      "Repo requests taken from the queue by lane.",
+	}, []string{"lane"})
+
+	MessagesSettled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "dataloader",
+		Name:      "messages_settled_total",
+		Help:      "Repo requests settled by lane and outcome.",
+	}, []string{"lane", "outcome"})
+
+	GithubRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "github",
+		Name:      "requests_total",
+		Help:      "GitHub GraphQL calls by response status.",
+	}, []string{"status"})
+
+	GithubQueryCost = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "github",
+		Name:      "query_cost_total",
+		Help:      "Rate limit points spent by GitHub GraphQL queries.",
+	})
+
+	GithubRateLimitRemaining = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "github",
+		Name:      "rate_limit_remaining",
+		Help:      "Rate limit points left by token fingerprint.",
+	}, []string{"token"})
+
+	JobPagesFetched = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "dataloader",
+		Name:      "job_pages_fetched",
+		Help:      "Pages of releases or tags fetched by a job.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+	})
+
+	MongoOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "mongo",
+		Name:      "operation_duration_seconds",
+		Help:      "Latency of Mongo commands by command and result.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"command", "result"})
+)
+
+// Outcomes of settled repo requests.
+const (
+	OutcomeAcked    = "acked"
+	OutcomeRequeued = "requeued"
+	OutcomeRetried  = "retried"
+	OutcomeDelayed  = "delayed"
+	OutcomeParked   = "parked"
+	OutcomeFailed   = "failed" // Settling the message failed.
+)
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,125 @@
+package mongostore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// EventOutboxCollectionName keeps domain events by their IDs. Published
+	// events are kept for a while, so a change announced again, e.g. by a
+	// retried fetch, is not queued for publishing again.
+	EventOutboxCollectionName = "event_outbox"
+
+	publishedEventTTL = 30 * 24 * time.Hour
+)
+
+// ErrEventClaimLost is returned when the claim of an event expired and the
+// event may be claimed by another relay.
+var ErrEventClaimLost = errors.New("event claim is lost")
+
+// PendingEvent is a domain event saved in the transaction of the change it
+// announces. A relay publishes it after the transaction is committed.
+type PendingEvent struct {
+	ID          string     `bson:"_id"`
+	Body        []byte     `bson:"body"`
+	Attempts    int        `bson:"attempts"`
+	CreatedAt   time.Time  `bson:"created_at"`
+	LockedUntil *time.Time `bson:"locked_until"`
+	PublishedAt *time.Time `bson:"published_at"`
+}
+
+// AddPendingEvents saves events whose IDs are not known yet. Known events are
+// left as they are, so it may run in transactions.
+func (store *Store) AddPendingEvents(ctx context.Context, events ...*PendingEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	models := make([]mongo.WriteModel, 0, len(events))
+	for _, event := range events {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.D{{"_id", event.ID}}).
+			SetUpdate(bson.D{{"$setOnInsert", bson.D{
+				{"body", event.Body},
+				{"attempts", 0},
+				{"created_at", time.Now()},
+				{"locked_until", nil},
+				{"published_at", nil},
+			}}}).
+			SetUpsert(true))
+	}
+
+	_, err := store.
+		Database(DatabaseName).
+		Collection(EventOutboxCollectionName).
+		BulkWrite(ctx, models)
+
+	return err
+}
+
+// ClaimPendingEvent locks the oldest unpublished event for the relay. Events of
+// a relay which did not mark them published are claimed again after the lock.
+// Returns mongo.ErrNoDocuments if there are no such events.
+func (store *Store) ClaimPendingEvent(ctx context.Context, lock time.Duration) (*PendingEvent, error) {
+	now := time.Now()
+
+	event := new(PendingEvent)
+	err := store.
+		Database(DatabaseName).
+		Collection(EventOutboxCollectionName).
+		FindOneAndUpdate(
+			ctx,
+			bson.D{
+				{"published_at", nil},
+				{"locked_until", bson.D{{"$not", bson.D{{"$gt", now}}}}},
+			},
+			bson.D{
+				{"$set", bson.D{{"locked_until", now.Add(lock)}}},
+				{"$inc", bson.D{{"attempts", 1}}},
+			},
+			options.FindOneAndUpdate().
+				SetSort(bson.D{{"created_at", 1}}).
+				SetReturnDocument(options.After),
+		).
+		Decode(event)
+	if err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// MarkEventPublished marks the event published if it is still claimed with
+// the lock returned by ClaimPendingEvent.
+func (store *Store) MarkEventPublished(ctx context.Context, event *PendingEvent) error {
+	result, err := store.
+		Database(DatabaseName).
+		Collection(EventOutboxCollectionName).
+		UpdateOne(
+			ctx,
+			bson.D{
+				{"_id", event.ID},
+				{"published_at", nil},
+				{"locked_until", event.LockedUntil},
+			},
+			bson.D{
+				{"$set", bson.D{{"published_at", time.Now()}}},
+				{"$unset", bson.D{{"locked_until", ""}}},
+			},
+		)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrEventClaimLost
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package mongostore
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	SourceEventsCollectionName = "source_events"
+	sourceEventsTTL            = 24 * time.Hour
+)
+
+const (
+	EventFetchStarted  = "fetch.started"
+	EventFetchProgress = "fetch.progress"
+	EventFetchFinished = "fetch.finished"
+	EventReleaseAdded  = "release.added"
+)
+
+type SourceEvent struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	SourceID  primitive.ObjectID `bson:"source_id" json:"sourceId"`
+	Type      string             `bson:"type" json:"type"`
+	CreatedAt time.Time          `bson:"created_at" json:"createdAt"`
+	Progress  *FetchProgress     `bson:"progress,omitempty" json:"progress,omitempty"`
+	Release   *Release           `bson:"release,omitempty" json:"release,omitempty"`
+	Error     string             `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+type FetchProgress struct {
+	PagesFetched    int `bson:"pages_fetched" json:"pagesFetched"`
+	ReleasesFetched int `bson:"releases_fetched" json:"releasesFetched"`
+}
+
+func (store *Store) AddSourceEvents(ctx context.Context, events ...*SourceEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	documents := make([]any, 0, len(events))
+	for _, event := range events {
+		if event.ID.IsZero() {
+			event.ID = primitive.NewObjectID()
+		}
+		if event.CreatedAt.IsZero() {
+			event.CreatedAt = time.Now()
+		}
+		documents = append(documents, event)
+	}
+
+	_, err := store.
+		Database(DatabaseName).
+		Collection(SourceEventsCollectionName).
+		InsertMany(ctx, documents)
+
+	return err
+}
+
+// GetSourceEventsAfter returns stored events newer than afterID. Events of
+// all sources are returned if no sourceIDs are given.
+func (store *Store) GetSourceEventsAfter(ctx context.Context, afterID primitive.ObjectID, sourceIDs ...primitive.ObjectID) ([]*SourceEvent, error) {
+	filter := bson.D{{"_id", bson.D{{"$gt", afterID}}}}
+	if len(sourceIDs) > 0 {
+		filter = append(filter, bson.E{"source_id", bson.D{{"$in", sourceIDs}}})
+	}
+
+	return GetDocuments(ctx, store, GetDocumentsOptions[SourceEvent]{
+		Collection:  SourceEventsCollectionName,
+		Filter:      filter,
+		FindOptions: options.Find().SetSort(bson.D{{"_id", 1}}).SetLimit(1000),
+	})
+}
+
+// WatchSourceEvents opens a change stream of newly inserted events of the
+// given types, or of any type if none given. Events of all sources are
+// watched if no sourceIDs are given. Decode stream items into
+// SourceEventChange.
+func (store *Store) WatchSourceEvents(ctx context.Context, eventTypes []string, sourceIDs ...primitive.ObjectID) (*mongo.ChangeStream, error) {
+	match := bson.D{{"operationType", "insert"}}
+	if len(eventTypes) > 0 {
+		match = append(match, bson.E{"fullDocument.type", bson.D{{"$in", eventTypes}}})
+	}
+	if len(sourceIDs) > 0 {
+		match = append(match, bson.E{"fullDocument.source_id", bson.D{{"$in", sourceIDs}}})
+	}
+
+	return store.
+		Database(DatabaseName).
+		Collection(SourceEventsCollectionName).
+		Watch(ctx, mongo.Pipeline{{{"$match", match}}})
+}
+
+type SourceEventChange struct {
+	FullDocument SourceEvent `bson:"fullDocument"`
+}
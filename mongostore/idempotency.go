@@ -0,0 +1,101 @@
+package mongostore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	IdempotencyKeysCollectionName = "idempotency_keys"
+	HandledMessagesCollectionName = "handled_messages"
+
+	idempotencyKeyTTL = 24 * time.Hour
+	handledMessageTTL = 7 * 24 * time.Hour
+)
+
+// IdempotencyKey reserves a key of a mutating request. The response is saved
+// once the request is handled.
+type IdempotencyKey struct {
+	Key         string          `bson:"_id"`
+	RequestHash string          `bson:"request_hash"`
+	Response    *StoredResponse `bson:"response,omitempty"`
+	CreatedAt   time.Time       `bson:"created_at"`
+}
+
+type StoredResponse struct {
+	Status int                 `bson:"status"`
+	Header map[string][]string `bson:"header"`
+	Body   []byte              `bson:"body"`
+}
+
+// ReserveIdempotencyKey saves the key unless it exists. Reports whether the
+// key is reserved, otherwise the existing key is returned.
+func (store *Store) ReserveIdempotencyKey(ctx context.Context, key, requestHash string) (*IdempotencyKey, bool, error) {
+	collection := store.Database(DatabaseName).Collection(IdempotencyKeysCollectionName)
+
+	reserved := &IdempotencyKey{Key: key, RequestHash: requestHash, CreatedAt: time.Now()}
+	_, err := collection.InsertOne(ctx, reserved)
+	if err == nil {
+		return reserved, true, nil
+	} else if !mongo.IsDuplicateKeyError(err) {
+		return nil, false, err
+	}
+
+	existing := new(IdempotencyKey)
+	if err := collection.FindOne(ctx, bson.D{{"_id", key}}).Decode(existing); err != nil {
+		return nil, false, err
+	}
+
+	return existing, false, nil
+}
+
+func (store *Store) SaveIdempotentResponse(ctx context.Context, key string, response *StoredResponse) error {
+	_, err := store.
+		Database(DatabaseName).
+		Collection(IdempotencyKeysCollectionName).
+		UpdateOne(ctx, bson.D{{"_id", key}}, bson.D{{"$set", bson.D{{"response", response}}}})
+
+	return err
+}
+
+// ReleaseIdempotencyKey removes the key of a failed request so it can be
+// retried.
+func (store *Store) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	_, err := store.
+		Database(DatabaseName).
+		Collection(IdempotencyKeysCollectionName).
+		DeleteOne(ctx, bson.D{{"_id", key}, {"response", nil}})
+
+	return err
+}
+
+func (store *Store) IsMessageHandled(ctx context.Context, deduplicationID string) (bool, error) {
+	err := store.
+		Database(DatabaseName).
+		Collection(HandledMessagesCollectionName).
+		FindOne(ctx, bson.D{{"_id", deduplicationID}}).
+		Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (store *Store) MarkMessageHandled(ctx context.Context, deduplicationID string) error {
+	_, err := store.
+		Database(DatabaseName).
+		Collection(HandledMessagesCollectionName).
+		InsertOne(ctx, bson.D{{"_id", deduplicationID}, {"handled_at", time.Now()}})
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+
+	return err
+}
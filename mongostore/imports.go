@@ -0,0 +1,202 @@
+package mongostore
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	ImportsCollectionName = "imports"
+	maxImportErrors       = 50
+)
+
+const (
+	ImportKindOrg       = "org"
+	ImportKindUserStars = "user_stars"
+	ImportKindLinks     = "links"
+)
+
+const (
+	ImportStatusQueued   = "queued"
+	ImportStatusRunning  = "running"
+	ImportStatusFinished = "finished"
+	ImportStatusFailed   = "failed"
+)
+
+// Import tracks progress of a bulk source import.
+type Import struct {
+	ID         primitive.ObjectID `bson:"_id" json:"id"`
+	Kind       string             `bson:"kind" json:"kind"`
+	Target     string             `bson:"target,omitempty" json:"target,omitempty"`
+	Status     string             `bson:"status" json:"status"`
+	Total      int                `bson:"total" json:"total"`
+	Processed  int                `bson:"processed" json:"processed"`
+	Added      int                `bson:"added" json:"added"`
+	Skipped    int                `bson:"skipped" json:"skipped"`
+	Failed     int                `bson:"failed" json:"failed"`
+	Errors     []ImportError      `bson:"errors" json:"errors"`
+	Error      string             `bson:"error,omitempty" json:"error,omitempty"`
+	Links      []string           `bson:"links,omitempty" json:"-"` // Kept to resume the import.
+	CreatedAt  time.Time          `bson:"created_at" json:"createdAt"`
+	UpdatedAt  time.Time          `bson:"updated_at" json:"updatedAt"`
+	FinishedAt *time.Time         `bson:"finished_at" json:"finishedAt"`
+}
+
+type ImportError struct {
+	Item  string `bson:"item" json:"item"`
+	Error string `bson:"error" json:"error"`
+}
+
+// ImportProgress is added to the import counters.
+type ImportProgress struct {
+	Processed int
+	Added     int
+	Skipped   int
+	Failed    int
+	Errors    []ImportError
+}
+
+func (store *Store) CreateImport(ctx context.Context, kind, target string, links []string) (*Import, error) {
+	now := time.Now()
+	imp := &Import{
+		ID:        primitive.NewObjectID(),
+		Kind:      kind,
+		Target:    target,
+		Status:    ImportStatusQueued,
+		Errors:    []ImportError{},
+		Links:     links,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	_, err := store.
+		Database(DatabaseName).
+		Collection(ImportsCollectionName).
+		InsertOne(ctx, imp)
+	if err != nil {
+		return nil, err
+	}
+
+	return imp, nil
+}
+
+func (store *Store) GetImport(ctx context.Context, id primitive.ObjectID) (*Import, error) {
+	imp := new(Import)
+	err := store.
+		Database(DatabaseName).
+		Collection(ImportsCollectionName).
+		FindOne(ctx, bson.D{{"_id", id}}).
+		Decode(imp)
+	if err != nil {
+		return nil, err
+	}
+
+	return imp, nil
+}
+
+// RenewImport tells other API instances that the import is still being run.
+func (store *Store) RenewImport(ctx context.Context, id primitive.ObjectID) error {
+	return store.updateImport(ctx, id, bson.D{{"$set", bson.D{{"updated_at", time.Now()}}}})
+}
+
+// ClaimStaleImport takes an unfinished import which was not renewed for the
+// stale period, e.g. because its API instance stopped. Returns
+// mongo.ErrNoDocuments if there are no such imports.
+func (store *Store) ClaimStaleImport(ctx context.Context, stalePeriod time.Duration) (*Import, error) {
+	now := time.Now()
+
+	imp := new(Import)
+	err := store.
+		Database(DatabaseName).
+		Collection(ImportsCollectionName).
+		FindOneAndUpdate(
+			ctx,
+			bson.D{
+				{"status", bson.D{{"$in", bson.A{ImportStatusQueued, ImportStatusRunning}}}},
+				{"updated_at", bson.D{{"$lte", now.Add(-stalePeriod)}}},
+			},
+			bson.D{{"$set", bson.D{{"updated_at", now}}}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).
+		Decode(imp)
+	if err != nil {
+		return nil, err
+	}
+
+	return imp, nil
+}
+
+func (store *Store) StartImport(ctx context.Context, id primitive.ObjectID, total int) error {
+	return store.updateImport(ctx, id, bson.D{
+		{"$set", bson.D{
+			{"status", ImportStatusRunning},
+			{"total", total},
+			{"updated_at", time.Now()},
+		}},
+	})
+}
+
+func (store *Store) AddImportProgress(ctx context.Context, id primitive.ObjectID, progress ImportProgress) error {
+	update := bson.D{
+		{"$inc", bson.D{
+			{"processed", progress.Processed},
+			{"added", progress.Added},
+			{"skipped", progress.Skipped},
+			{"failed", progress.Failed},
+		}},
+		{"$set", bson.D{{"updated_at", time.Now()}}},
+	}
+
+	if len(progress.Errors) > 0 {
+		update = append(update, bson.E{"$push", bson.D{{"errors", bson.D{
+			{"$each", progress.Errors},
+			{"$slice", -maxImportErrors},
+		}}}})
+	}
+
+	return store.updateImport(ctx, id, update)
+}
+
+// FinishImport marks the import as finished, or failed if importErr is set.
+func (store *Store) FinishImport(ctx context.Context, id primitive.ObjectID, importErr error) error {
+	now := time.Now()
+	set := bson.D{
+		{"status", ImportStatusFinished},
+		{"updated_at", now},
+		{"finished_at", now},
+	}
+
+	if importErr != nil {
+		set[0].Value = ImportStatusFailed
+		set = append(set, bson.E{"error", importErr.Error()})
+	}
+
+	return store.updateImport(ctx, id, bson.D{{"$set", set}})
+}
+
+func (store *Store) updateImport(ctx context.Context, id primitive.ObjectID, update bson.D) error {
+	_, err := store.
+		Database(DatabaseName).
+		Collection(ImportsCollectionName).
+		UpdateOne(ctx, bson.D{{"_id", id}}, update)
+
+	return err
+}
+
+// SourceExists tells whether the source is tracked. Deleted sources are not,
+// adding them again restores them.
+func (store *Store) SourceExists(ctx context.Context, externalID string) (bool, error) {
+	count, err := store.
+		Database(DatabaseName).
+		Collection(SourcesCollectionName).
+		CountDocuments(ctx, bson.D{{"external_id", externalID}, {"deleted_at", nil}}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
@@ -0,0 +1,156 @@
+package mongostore
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const JobsCollectionName = "jobs"
+
+const (
+	JobStatusQueued      = "queued"
+	JobStatusRunning     = "running"
+	JobStatusSucceeded   = "succeeded"
+	JobStatusFailed      = "failed"
+	JobStatusRateLimited = "rate_limited"
+)
+
+// Job is a request to fetch releases of a source.
+type Job struct {
+	ID              primitive.ObjectID `bson:"_id" json:"id"`
+	SourceID        primitive.ObjectID `bson:"source_id" json:"sourceId"`
+	Status          string             `bson:"status" json:"status"`
+	Attempts        int                `bson:"attempts" json:"attempts"`
+	Error           string             `bson:"error,omitempty" json:"error,omitempty"`
+	PagesFetched    int                `bson:"pages_fetched" json:"pagesFetched"`
+	ReleasesFetched int                `bson:"releases_fetched" json:"releasesFetched"`
+	CreatedAt       time.Time          `bson:"created_at" json:"createdAt"`
+	UpdatedAt       time.Time          `bson:"updated_at" json:"updatedAt"`
+	StartedAt       *time.Time         `bson:"started_at" json:"startedAt"`
+	FinishedAt      *time.Time         `bson:"finished_at" json:"finishedAt"`
+}
+
+func (store *Store) CreateJob(ctx context.Context, sourceID primitive.ObjectID) (*Job, error) {
+	now := time.Now()
+	job := &Job{
+		ID:        primitive.NewObjectID(),
+		SourceID:  sourceID,
+		Status:    JobStatusQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	_, err := store.
+		Database(DatabaseName).
+		Collection(JobsCollectionName).
+		InsertOne(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (store *Store) GetJob(ctx context.Context, id primitive.ObjectID) (*Job, error) {
+	job := new(Job)
+	err := store.
+		Database(DatabaseName).
+		Collection(JobsCollectionName).
+		FindOne(ctx, bson.D{{"_id", id}}).
+		Decode(job)
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// GetActiveJob returns the latest job of the source which is not finished.
+func (store *Store) GetActiveJob(ctx context.Context, sourceID primitive.ObjectID) (*Job, error) {
+	job := new(Job)
+	err := store.
+		Database(DatabaseName).
+		Collection(JobsCollectionName).
+		FindOne(
+			ctx,
+			bson.D{
+				{"source_id", sourceID},
+				{"status", bson.D{{"$in", bson.A{JobStatusQueued, JobStatusRunning, JobStatusRateLimited}}}},
+			},
+			options.FindOne().SetSort(bson.D{{"_id", -1}}),
+		).
+		Decode(job)
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// GetSourceJobs returns the latest jobs of the source, newest first.
+func (store *Store) GetSourceJobs(ctx context.Context, sourceID primitive.ObjectID, limit int) ([]*Job, error) {
+	return GetDocuments(ctx, store, GetDocumentsOptions[Job]{
+		Collection: JobsCollectionName,
+		Filter:     bson.D{{"source_id", sourceID}},
+		FindOptions: options.
+			Find().
+			SetSort(bson.D{{"_id", -1}}).
+			SetLimit(int64(limit)),
+	})
+}
+
+// StartJob marks the job as running and counts the attempt.
+func (store *Store) StartJob(ctx context.Context, id primitive.ObjectID) error {
+	now := time.Now()
+	return store.updateJob(ctx, id, bson.D{
+		{"$set", bson.D{
+			{"status", JobStatusRunning},
+			{"started_at", now},
+			{"updated_at", now},
+		}},
+		{"$unset", bson.D{{"error", ""}}},
+		{"$inc", bson.D{{"attempts", 1}}},
+	})
+}
+
+func (store *Store) SetJobProgress(ctx context.Context, id primitive.ObjectID, pagesFetched, releasesFetched int) error {
+	return store.updateJob(ctx, id, bson.D{
+		{"$set", bson.D{
+			{"pages_fetched", pagesFetched},
+			{"releases_fetched", releasesFetched},
+			{"updated_at", time.Now()},
+		}},
+	})
+}
+
+// FinishJob sets the status of the job. Only succeeded and failed jobs get the
+// finish time, others are going to be retried.
+func (store *Store) FinishJob(ctx context.Context, id primitive.ObjectID, status string, jobErr error) error {
+	now := time.Now()
+	set := bson.D{
+		{"status", status},
+		{"updated_at", now},
+	}
+
+	if status == JobStatusSucceeded || status == JobStatusFailed {
+		set = append(set, bson.E{"finished_at", now})
+	}
+	if jobErr != nil {
+		set = append(set, bson.E{"error", jobErr.Error()})
+	}
+
+	return store.updateJob(ctx, id, bson.D{{"$set", set}})
+}
+
+func (store *Store) updateJob(ctx context.Context, id primitive.ObjectID, update bson.D) error {
+	_, err := store.
+		Database(DatabaseName).
+		Collection(JobsCollectionName).
+		UpdateOne(ctx, bson.D{{"_id", id}}, update)
+
+	return err
+}
@@ -0,0 +1,157 @@
+package mongostore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// FetchLeaseTTL is how long a dataloader owns a source without renewing
+	// the lease.
+	FetchLeaseTTL = 1 * time.Minute
+
+	// QueuedFetchLeaseTTL covers the wait of a queued fetch, including a retry
+	// after rate limits or in the longest retry tier.
+	QueuedFetchLeaseTTL = 3 * time.Hour
+)
+
+var (
+	ErrFetchLeaseHeld = errors.New("fetch lease is held by another owner")
+	ErrFetchLeaseLost = errors.New("fetch lease is lost")
+)
+
+// FetchLease marks a source as being fetched until the lease expires. Queued
+// fetches have a lease without an owner.
+type FetchLease struct {
+	Owner     string    `bson:"owner"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// isFetchingExpr tells whether the fetch lease of a source is not expired.
+var isFetchingExpr = bson.D{{"$gt", bson.A{"$fetch_lease.expires_at", "$$NOW"}}}
+
+// fetchLeaseExpired matches sources without an active fetch lease.
+func fetchLeaseExpired(now time.Time) bson.E {
+	return bson.E{"fetch_lease.expires_at", bson.D{{"$not", bson.D{{"$gt", now}}}}}
+}
+
+// QueueFetch gives the source a queued fetch lease unless it is being fetched.
+func (store *Store) QueueFetch(ctx context.Context, sourceID primitive.ObjectID) error {
+	queued := FetchLease{ExpiresAt: time.Now().Add(QueuedFetchLeaseTTL)}
+
+	_, err := store.
+		Database(DatabaseName).
+		Collection(SourcesCollectionName).
+		UpdateOne(ctx, bson.D{{"_id", sourceID}}, bson.A{
+			bson.D{{"$set", bson.D{
+				{"fetch_lease", bson.D{{"$cond", bson.A{isFetchingExpr, "$fetch_lease", queued}}}},
+			}}},
+		})
+
+	return err
+}
+
+// AcquireFetchLease takes a queued or expired lease of the source. Deleted
+// sources can not be leased.
+func (store *Store) AcquireFetchLease(ctx context.Context, sourceID primitive.ObjectID, owner string) error {
+	now := time.Now()
+
+	result, err := store.
+		Database(DatabaseName).
+		Collection(SourcesCollectionName).
+		UpdateOne(
+			ctx,
+			bson.D{
+				{"_id", sourceID},
+				{"deleted_at", nil},
+				{"$or", bson.A{
+					bson.D{{"fetch_lease.owner", ""}},
+					bson.D{fetchLeaseExpired(now)},
+				}},
+			},
+			bson.D{{"$set", bson.D{
+				{"fetch_lease", FetchLease{Owner: owner, ExpiresAt: now.Add(FetchLeaseTTL)}},
+			}}},
+		)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrFetchLeaseHeld
+	}
+
+	return nil
+}
+
+func (store *Store) RenewFetchLease(ctx context.Context, sourceID primitive.ObjectID, owner string) error {
+	result, err := store.
+		Database(DatabaseName).
+		Collection(SourcesCollectionName).
+		UpdateOne(
+			ctx,
+			bson.D{{"_id", sourceID}, {"fetch_lease.owner", owner}},
+			bson.D{{"$set", bson.D{{"fetch_lease.expires_at", time.Now().Add(FetchLeaseTTL)}}}},
+		)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrFetchLeaseLost
+	}
+
+	return nil
+}
+
+// ReleaseFetchLease removes the lease of the owner. The source is left queued
+// if the fetch is going to be retried.
+func (store *Store) ReleaseFetchLease(ctx context.Context, sourceID primitive.ObjectID, owner string, requeue bool) error {
+	update := bson.D{{"$unset", bson.D{{"fetch_lease", ""}}}}
+	if requeue {
+		update = bson.D{{"$set", bson.D{
+			{"fetch_lease", FetchLease{ExpiresAt: time.Now().Add(QueuedFetchLeaseTTL)}},
+		}}}
+	}
+
+	_, err := store.
+		Database(DatabaseName).
+		Collection(SourcesCollectionName).
+		UpdateOne(ctx, bson.D{{"_id", sourceID}, {"fetch_lease.owner", owner}}, update)
+
+	return err
+}
+
+// ReclaimExpiredFetchLease finds a source whose fetch lease expired without
+// being released and queues it again. Returns mongo.ErrNoDocuments if there
+// are no such sources.
+func (store *Store) ReclaimExpiredFetchLease(ctx context.Context) (*Source, error) {
+	now := time.Now()
+
+	source := new(Source)
+	err := store.
+		Database(DatabaseName).
+		Collection(SourcesCollectionName).
+		FindOneAndUpdate(
+			ctx,
+			bson.D{
+				{"deleted_at", nil},
+				{"fetch_lease.expires_at", bson.D{{"$lte", now}}},
+			},
+			bson.D{{"$set", bson.D{
+				{"fetch_lease", FetchLease{ExpiresAt: now.Add(QueuedFetchLeaseTTL)}},
+			}}},
+			options.FindOneAndUpdate().
+				SetReturnDocument(options.After).
+				SetProjection(SourceBriefProjection),
+		).
+		Decode(source)
+	if err != nil {
+		return nil, err
+	}
+
+	return source, nil
+}
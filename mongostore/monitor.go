@@ -0,0 +1,26 @@
+package mongostore
+
+import (
+	"context"
+
+	"github.com/lesnoi-kot/versions-backend/metrics"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+)
+
+// newCommandMonitor traces Mongo commands and observes their latency.
+func newCommandMonitor() *event.CommandMonitor {
+	tracing := otelmongo.NewMonitor()
+
+	return &event.CommandMonitor{
+		Started: tracing.Started,
+		Succeeded: func(ctx context.Context, evt *event.CommandSucceededEvent) {
+			tracing.Succeeded(ctx, evt)
+			metrics.MongoOperationDuration.WithLabelValues(evt.CommandName, "success").Observe(evt.Duration.Seconds())
+		},
+		Failed: func(ctx context.Context, evt *event.CommandFailedEvent) {
+			tracing.Failed(ctx, evt)
+			metrics.MongoOperationDuration.WithLabelValues(evt.CommandName, "failure").Observe(evt.Duration.Seconds())
+		},
+	}
+}
@@ -0,0 +1,94 @@
+package mongostore
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	OutboxCollectionName = "outbox"
+
+	sentOutboxMessageTTL = 7 * 24 * time.Hour
+)
+
+// OutboxMessage is a queue message saved in the transaction of the change it
+// announces. A relay publishes it after the transaction is committed.
+type OutboxMessage struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Lane        string             `bson:"lane"`
+	Body        []byte             `bson:"body"`
+	Attempts    int                `bson:"attempts"`
+	CreatedAt   time.Time          `bson:"created_at"`
+	LockedUntil *time.Time         `bson:"locked_until"`
+	SentAt      *time.Time         `bson:"sent_at"`
+
+	// TraceContext links the publishing to the trace of the change.
+	TraceContext map[string]string `bson:"trace_context,omitempty"`
+}
+
+func (store *Store) AddOutboxMessage(ctx context.Context, lane string, body []byte, traceContext map[string]string) error {
+	_, err := store.
+		Database(DatabaseName).
+		Collection(OutboxCollectionName).
+		InsertOne(ctx, &OutboxMessage{
+			ID:           primitive.NewObjectID(),
+			Lane:         lane,
+			Body:         body,
+			CreatedAt:    time.Now(),
+			TraceContext: traceContext,
+		})
+
+	return err
+}
+
+// ClaimOutboxMessage locks the oldest unsent message for the relay. Messages
+// of a relay which did not mark them sent are claimed again after the lock.
+// Returns mongo.ErrNoDocuments if there are no such messages.
+func (store *Store) ClaimOutboxMessage(ctx context.Context, lock time.Duration) (*OutboxMessage, error) {
+	now := time.Now()
+
+	msg := new(OutboxMessage)
+	err := store.
+		Database(DatabaseName).
+		Collection(OutboxCollectionName).
+		FindOneAndUpdate(
+			ctx,
+			bson.D{
+				{"sent_at", nil},
+				{"locked_until", bson.D{{"$not", bson.D{{"$gt", now}}}}},
+			},
+			bson.D{
+				{"$set", bson.D{{"locked_until", now.Add(lock)}}},
+				{"$inc", bson.D{{"attempts", 1}}},
+			},
+			options.FindOneAndUpdate().
+				SetSort(bson.D{{"_id", 1}}).
+				SetReturnDocument(options.After),
+		).
+		Decode(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+func (store *Store) MarkOutboxMessageSent(ctx context.Context, id primitive.ObjectID) error {
+	_, err := store.
+		Database(DatabaseName).
+		Collection(OutboxCollectionName).
+		UpdateOne(
+			ctx,
+			bson.D{{"_id", id}},
+			bson.D{
+				{"$set", bson.D{{"sent_at", time.Now()}}},
+				{"$unset", bson.D{{"locked_until", ""}}},
+			},
+		)
+
+	return err
+}
@@ -0,0 +1,120 @@
+package mongostore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const GithubRateLimitsCollectionName = "github_rate_limits"
+
+// GithubRateLimit is the GitHub API budget of a token shared by dataloaders.
+// Requests are spread evenly until the budget is reset.
+type GithubRateLimit struct {
+	ID            string    `bson:"_id"`
+	Remaining     int       `bson:"remaining"`
+	ResetAt       time.Time `bson:"reset_at"`
+	NextRequestAt time.Time `bson:"next_request_at"`
+	UpdatedAt     time.Time `bson:"updated_at"`
+}
+
+// ReserveGithubRequest takes the next request slot of the token and returns
+// its time. Slots of an exhausted budget start at its reset.
+func (store *Store) ReserveGithubRequest(ctx context.Context, id string) (time.Time, error) {
+	now := time.Now()
+	remaining := bson.D{{"$ifNull", bson.A{"$remaining", 1}}}
+
+	slot := bson.D{{"$max", bson.A{
+		"$next_request_at",
+		now,
+		bson.D{{"$cond", bson.A{bson.D{{"$lte", bson.A{remaining, 0}}}, "$reset_at", now}}},
+	}}}
+
+	// Interval between requests to stretch the remaining budget until reset.
+	interval := bson.D{{"$cond", bson.A{
+		bson.D{{"$gt", bson.A{"$reset_at", "$reserved_at"}}},
+		bson.D{{"$divide", bson.A{
+			bson.D{{"$subtract", bson.A{"$reset_at", "$reserved_at"}}},
+			bson.D{{"$max", bson.A{remaining, 1}}},
+		}}},
+		0,
+	}}}
+
+	reserved := new(struct {
+		ReservedAt time.Time `bson:"reserved_at"`
+	})
+
+	err := store.
+		Database(DatabaseName).
+		Collection(GithubRateLimitsCollectionName).
+		FindOneAndUpdate(
+			ctx,
+			bson.D{{"_id", id}},
+			bson.A{
+				bson.D{{"$set", bson.D{{"reserved_at", slot}}}},
+				bson.D{{"$set", bson.D{
+					{"next_request_at", bson.D{{"$add", bson.A{"$reserved_at", interval}}}},
+					{"remaining", bson.D{{"$max", bson.A{bson.D{{"$subtract", bson.A{remaining, 1}}}, 0}}}},
+					{"updated_at", now},
+				}}},
+			},
+			options.FindOneAndUpdate().
+				SetUpsert(true).
+				SetReturnDocument(options.After).
+				SetProjection(bson.D{{"reserved_at", 1}}),
+		).
+		Decode(reserved)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return reserved.ReservedAt, nil
+}
+
+// SaveGithubRateLimit replaces the budget of the token with the one reported
+// by GitHub.
+func (store *Store) SaveGithubRateLimit(ctx context.Context, id string, remaining int, resetAt time.Time) error {
+	_, err := store.
+		Database(DatabaseName).
+		Collection(GithubRateLimitsCollectionName).
+		UpdateOne(
+			ctx,
+			bson.D{{"_id", id}},
+			bson.D{{"$set", bson.D{
+				{"remaining", remaining},
+				{"reset_at", resetAt},
+				{"updated_at", time.Now()},
+			}}},
+			options.Update().SetUpsert(true),
+		)
+
+	return err
+}
+
+// GetGithubResetAt returns the earliest budget reset of the tokens. It is zero
+// if no budget is known.
+func (store *Store) GetGithubResetAt(ctx context.Context, ids []string) (time.Time, error) {
+	rateLimit := new(GithubRateLimit)
+	err := store.
+		Database(DatabaseName).
+		Collection(GithubRateLimitsCollectionName).
+		FindOne(
+			ctx,
+			bson.D{{"_id", bson.D{{"$in", ids}}}, {"reset_at", bson.D{{"$ne", nil}}}},
+			options.FindOne().
+				SetSort(bson.D{{"reset_at", 1}}).
+				SetProjection(bson.D{{"reset_at", 1}}),
+		).
+		Decode(rateLimit)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+
+	return rateLimit.ResetAt, nil
+}
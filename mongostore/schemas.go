@@ -22,8 +22,12 @@ type Source struct {
 	Description string             `bson:"description" json:"description,omitempty"`
 	URL         string             `bson:"url" json:"url,omitempty"`
 	Releases    []Release          `bson:"releases" json:"releases,omitempty"`
-	IsFetching  bool               `bson:"is_fetching" json:"isFetching"`
+	IsFetching  bool               `bson:"is_fetching" json:"isFetching"` // Projected from FetchLease
 	EndCursor   *string            `bson:"end_cursor" json:"-"`
+	DeletedAt   *time.Time         `bson:"deleted_at,omitempty" json:"deletedAt,omitempty"`
+
+	RefreshRequestedAt *time.Time  `bson:"refresh_requested_at,omitempty" json:"-"`
+	FetchLease         *FetchLease `bson:"fetch_lease,omitempty" json:"-"`
 }
 
 type Release struct {
@@ -51,3 +55,39 @@ func (r *Release) ParseTagName() {
 	r.Patch = version.Patch()
 	r.IsPrerelease = version.Prerelease() != ""
 }
+
+// LatestStableRelease returns the release with the highest semantic version,
+// or the most recently published one if the source does not follow semver.
+func (s *Source) LatestStableRelease() *Release {
+	var latest *Release
+
+	for i := range s.Releases {
+		release := &s.Releases[i]
+		if release.IsPrerelease || !release.IsSemver {
+			continue
+		}
+
+		if latest == nil || compareReleaseVersions(release, latest) > 0 {
+			latest = release
+		}
+	}
+
+	if latest == nil && len(s.Releases) > 0 {
+		latest = &s.Releases[len(s.Releases)-1] // Releases are sorted by publish date
+	}
+
+	return latest
+}
+
+func compareReleaseVersions(a, b *Release) int {
+	for _, diff := range [][2]uint64{{a.Major, b.Major}, {a.Minor, b.Minor}, {a.Patch, b.Patch}} {
+		if diff[0] != diff[1] {
+			if diff[0] > diff[1] {
+				return 1
+			}
+			return -1
+		}
+	}
+
+	return 0
+}
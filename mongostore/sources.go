@@ -0,0 +1,214 @@
+package mongostore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const sourcesQueryMaxTime = 5 * time.Second
+
+// SourcesQuery describes a page of sources optionally filtered by name.
+type SourcesQuery struct {
+	Name  string
+	Page  int
+	Count int
+}
+
+// Filter matches sources which are not deleted.
+func (q SourcesQuery) Filter() bson.D {
+	filter := bson.D{{"deleted_at", nil}}
+	if q.Name != "" {
+		filter = append(filter, bson.E{"name", primitive.Regex{Pattern: q.Name, Options: "i"}})
+	}
+
+	return filter
+}
+
+func (q SourcesQuery) FindOptions() *options.FindOptions {
+	return options.
+		Find().
+		SetProjection(SourceBriefProjection).
+		SetSkip(int64(q.Page * q.Count)).
+		SetLimit(int64(q.Count)).
+		SetMaxTime(sourcesQueryMaxTime)
+}
+
+// FindSources returns a page of sources along with the total count of sources
+// matched by the query.
+func FindSources[T any](ctx context.Context, store *Store, q SourcesQuery) ([]*T, int64, error) {
+	filter := q.Filter()
+
+	sources, err := GetDocuments(ctx, store, GetDocumentsOptions[T]{
+		Collection:  SourcesCollectionName,
+		Filter:      filter,
+		FindOptions: q.FindOptions(),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	totalCount, err := store.GetDocumentsCount(ctx, SourcesCollectionName, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return sources, totalCount, nil
+}
+
+// SourceBriefProjection selects a source without releases and tells whether
+// it is being fetched by its lease.
+var SourceBriefProjection = bson.D{
+	{"_id", true},
+	{"created_at", true},
+	{"updated_at", true},
+	{"external_id", true},
+	{"owner", true},
+	{"name", true},
+	{"description", true},
+	{"url", true},
+	{"deleted_at", true},
+	{"refresh_requested_at", true},
+	{"is_fetching", isFetchingExpr},
+}
+
+// SourceProjection selects a full source but hides its releases while they
+// are being fetched.
+var SourceProjection = append(bson.D{
+	{"releases", bson.D{
+		{"$cond", bson.D{
+			{"if", isFetchingExpr},
+			{"then", nil},
+			{"else", "$releases"},
+		}},
+	}},
+}, SourceBriefProjection...)
+
+// GetSource returns a source which is not deleted.
+func (store *Store) GetSource(ctx context.Context, id primitive.ObjectID) (*Source, error) {
+	return store.GetSourceBy(
+		ctx,
+		bson.D{{"_id", id}, {"deleted_at", nil}},
+		options.FindOne().SetProjection(SourceProjection),
+	)
+}
+
+// GetSourcesByIDs returns sources in arbitrary order, missing and deleted
+// sources are skipped.
+func (store *Store) GetSourcesByIDs(ctx context.Context, ids []primitive.ObjectID) ([]*Source, error) {
+	return GetDocuments(ctx, store, GetDocumentsOptions[Source]{
+		Collection: SourcesCollectionName,
+		Filter:     bson.D{{"_id", bson.D{{"$in", ids}}}, {"deleted_at", nil}},
+		FindOptions: options.
+			Find().
+			SetProjection(SourceProjection).
+			SetMaxTime(sourcesQueryMaxTime),
+	})
+}
+
+// DeleteSource marks the source as deleted. The deletion time of an already
+// deleted source is kept.
+func (store *Store) DeleteSource(ctx context.Context, id primitive.ObjectID) error {
+	return store.
+		Database(DatabaseName).
+		Collection(SourcesCollectionName).
+		FindOneAndUpdate(ctx, bson.D{{"_id", id}}, bson.A{
+			bson.D{{"$set", bson.D{
+				{"deleted_at", bson.D{{"$ifNull", bson.A{"$deleted_at", "$$NOW"}}}},
+			}}},
+			// A running fetch loses its lease and stops.
+			bson.D{{"$unset", "fetch_lease"}},
+		}).
+		Err()
+}
+
+// RestoreSource clears the deletion mark. Sources which are not deleted are not
+// matched.
+func (store *Store) RestoreSource(ctx context.Context, id primitive.ObjectID) (*Source, error) {
+	source := new(Source)
+	err := store.
+		Database(DatabaseName).
+		Collection(SourcesCollectionName).
+		FindOneAndUpdate(
+			ctx,
+			bson.D{{"_id", id}, {"deleted_at", bson.D{{"$ne", nil}}}},
+			bson.D{
+				{"$set", bson.D{{"updated_at", time.Now()}}},
+				{"$unset", bson.D{{"deleted_at", ""}}},
+			},
+			options.FindOneAndUpdate().
+				SetReturnDocument(options.After).
+				SetProjection(SourceBriefProjection),
+		).
+		Decode(source)
+	if err != nil {
+		return nil, err
+	}
+
+	return source, nil
+}
+
+// PurgeDeletedSources removes sources deleted before the given time.
+func (store *Store) PurgeDeletedSources(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := store.
+		Database(DatabaseName).
+		Collection(SourcesCollectionName).
+		DeleteMany(ctx, bson.D{{"deleted_at", bson.D{{"$lt", deletedBefore}}}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// StartSourceRefresh queues a fetch of the source unless it is already
+// fetching or was refreshed less than minInterval ago. Reports whether the
+// refresh was started, otherwise the current state of the source is returned.
+func (store *Store) StartSourceRefresh(ctx context.Context, id primitive.ObjectID, minInterval time.Duration) (*Source, bool, error) {
+	now := time.Now()
+	source := new(Source)
+	err := store.
+		Database(DatabaseName).
+		Collection(SourcesCollectionName).
+		FindOneAndUpdate(
+			ctx,
+			bson.D{
+				{"_id", id},
+				{"deleted_at", nil},
+				fetchLeaseExpired(now),
+				{"$or", bson.A{
+					bson.D{{"refresh_requested_at", nil}},
+					bson.D{{"refresh_requested_at", bson.D{{"$lte", now.Add(-minInterval)}}}},
+				}},
+			},
+			bson.D{{"$set", bson.D{
+				{"fetch_lease", FetchLease{ExpiresAt: now.Add(QueuedFetchLeaseTTL)}},
+				{"refresh_requested_at", now},
+			}}},
+			options.FindOneAndUpdate().
+				SetReturnDocument(options.After).
+				SetProjection(SourceBriefProjection),
+		).
+		Decode(source)
+	if err == nil {
+		return source, true, nil
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, false, err
+	}
+
+	source, err = store.GetSourceBy(
+		ctx,
+		bson.D{{"_id", id}, {"deleted_at", nil}},
+		options.FindOne().SetProjection(SourceBriefProjection),
+	)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return source, false, nil
+}
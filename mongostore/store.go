@@ -18,7 +18,7 @@ func ConnectStore(ctx context.Context, mongoURI string) (*Store, error) {
 	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	client, err := mongo.Connect(timeoutCtx, options.Client().ApplyURI(mongoURI))
+	client, err := mongo.Connect(timeoutCtx, options.Client().ApplyURI(mongoURI).SetMonitor(newCommandMonitor()))
 	if err != nil {
 		return nil, err
 	}
@@ -27,18 +27,71 @@ func ConnectStore(ctx context.Context, mongoURI string) (*Store, error) {
 		return nil, err
 	}
 
-	_, err = client.
-		Database(DatabaseName).
-		Collection(SourcesCollectionName).
-		Indexes().
-		CreateOne(timeoutCtx, mongo.IndexModel{Keys: bson.D{{"name", "text"}}})
-	if err != nil {
+	if err := createIndexes(timeoutCtx, client.Database(DatabaseName)); err != nil {
 		return nil, err
 	}
 
 	return &Store{client}, nil
 }
 
+func createIndexes(ctx context.Context, db *mongo.Database) error {
+	indexes := map[string][]mongo.IndexModel{
+		SourcesCollectionName: {
+			{Keys: bson.D{{"name", "text"}}},
+			{Keys: bson.D{{"external_id", 1}}},
+			{Keys: bson.D{{"deleted_at", 1}}, Options: options.Index().SetSparse(true)},
+			{Keys: bson.D{{"fetch_lease.expires_at", 1}}, Options: options.Index().SetSparse(true)},
+		},
+		SourceEventsCollectionName: {
+			{Keys: bson.D{{"source_id", 1}, {"_id", 1}}},
+			{
+				Keys:    bson.D{{"created_at", 1}},
+				Options: options.Index().SetExpireAfterSeconds(int32(sourceEventsTTL.Seconds())),
+			},
+		},
+		JobsCollectionName: {
+			{Keys: bson.D{{"source_id", 1}, {"_id", -1}}},
+		},
+		ImportsCollectionName: {
+			{Keys: bson.D{{"status", 1}, {"updated_at", 1}}},
+		},
+		IdempotencyKeysCollectionName: {
+			{
+				Keys:    bson.D{{"created_at", 1}},
+				Options: options.Index().SetExpireAfterSeconds(int32(idempotencyKeyTTL.Seconds())),
+			},
+		},
+		HandledMessagesCollectionName: {
+			{
+				Keys:    bson.D{{"handled_at", 1}},
+				Options: options.Index().SetExpireAfterSeconds(int32(handledMessageTTL.Seconds())),
+			},
+		},
+		OutboxCollectionName: {
+			{Keys: bson.D{{"sent_at", 1}, {"_id", 1}}},
+			{
+				Keys:    bson.D{{"sent_at", 1}},
+				Options: options.Index().SetExpireAfterSeconds(int32(sentOutboxMessageTTL.Seconds())),
+			},
+		},
+		EventOutboxCollectionName: {
+			{Keys: bson.D{{"published_at", 1}, {"created_at", 1}}},
+			{
+				Keys:    bson.D{{"published_at", 1}},
+				Options: options.Index().SetExpireAfterSeconds(int32(publishedEventTTL.Seconds())),
+			},
+		},
+	}
+
+	for collection, models := range indexes {
+		if _, err := db.Collection(collection).Indexes().CreateMany(ctx, models); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 type GetDocumentsOptions[T any] struct {
 	Collection  string
 	Filter      bson.D
@@ -1,15 +1,157 @@
 package mq
 
-import "github.com/rabbitmq/amqp091-go"
+import (
+	"context"
+	"strconv"
+	"time"
 
+	"github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+)
+
+// amqpDelivery settles a delivery by publishing it to the retry, delayed or
+// parking lot queues. It is rejected to the first retry tier of its lane if
+// publishing fails.
+type amqpDelivery struct {
+	conn *AMQPConnection
+	msg  amqp091.Delivery
+}
+
+func (d *amqpDelivery) Lane() Lane {
+	return GetDeliveryLane(&d.msg)
+}
+
+func (d *amqpDelivery) Body() []byte {
+	return d.msg.Body
+}
+
+func (d *amqpDelivery) MessageID() string {
+	return d.msg.MessageId
+}
+
+func (d *amqpDelivery) Context(ctx context.Context) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, amqpHeaderCarrier(d.msg.Headers))
+}
+
+// Retries counts rejections of the lane queue and expirations of retry tiers
+// as well.
+func (d *amqpDelivery) Retries() int {
+	retries := GetDeliveryRetryCount(&d.msg)
+	if deathCount := int(GetDeliveryDeathCount(&d.msg)); deathCount > retries {
+		retries = deathCount
+	}
+
+	return retries
+}
+
+func (d *amqpDelivery) Ack() error {
+	return d.msg.Ack(false)
+}
+
+func (d *amqpDelivery) Requeue() error {
+	return d.msg.Nack(false, true)
+}
+
+func (d *amqpDelivery) Retry(ctx context.Context) error {
+	retry := d.Retries() + 1
+
+	msg := d.republishing()
+	msg.Headers[retryCountHeader] = int32(retry)
+
+	return d.move(ctx, retryQueueName(d.Lane(), retry), msg)
+}
+
+func (d *amqpDelivery) Delay(ctx context.Context, delay time.Duration) error {
+	return d.move(ctx, delayedQueueName(d.Lane()), d.delayed(delay))
+}
+
+// delayed is the publishing of the request to the delayed queue. It keeps the
+// retry count, and deaths in the delayed queue are not counted by Retries.
+func (d *amqpDelivery) delayed(delay time.Duration) amqp091.Publishing {
+	msg := d.republishing()
+	if retries := d.Retries(); retries > 0 {
+		msg.Headers[retryCountHeader] = int32(retries)
+	}
+	msg.Expiration = strconv.FormatInt(delay.Milliseconds(), 10)
+
+	return msg
+}
+
+func (d *amqpDelivery) Park(ctx context.Context, reason string) error {
+	msg := d.republishing()
+	for name, value := range d.msg.Headers {
+		msg.Headers[name] = value
+	}
+	msg.Headers[parkedReasonHeader] = reason
+	msg.Headers[parkedQueueHeader] = d.msg.RoutingKey
+	msg.Headers[parkedAtHeader] = time.Now().UTC().Format(time.RFC3339)
+
+	if msg.MessageId == "" {
+		msg.MessageId = newMessageID()
+	}
+
+	return d.move(ctx, ParkingLotQueueName, msg)
+}
+
+func (d *amqpDelivery) republishing() amqp091.Publishing {
+	return amqp091.Publishing{
+		Headers:      traceHeaders(d.msg.Headers),
+		ContentType:  d.msg.ContentType,
+		DeliveryMode: amqp091.Persistent,
+		MessageId:    d.msg.MessageId,
+		Body:         d.msg.Body,
+	}
+}
+
+// move publishes the message to the queue and acks the delivery.
+func (d *amqpDelivery) move(ctx context.Context, queue string, msg amqp091.Publishing) error {
+	if err := d.conn.publish(ctx, queue, msg); err != nil {
+		d.msg.Reject(false)
+		return err
+	}
+
+	return d.msg.Ack(false)
+}
+
+// GetDeliveryLane tells the lane of a delivered repo request.
+func GetDeliveryLane(msg *amqp091.Delivery) Lane {
+	if msg.RoutingKey == LaneBackground.QueueName() {
+		return LaneBackground
+	}
+
+	return LaneInteractive
+}
+
+// GetDeliveryRetryCount tells the number of retries of a repo request.
+func GetDeliveryRetryCount(msg *amqp091.Delivery) int {
+	switch count := msg.Headers[retryCountHeader].(type) {
+	case int32:
+		return int(count)
+	case int64:
+		return int(count)
+	}
+
+	return 0
+}
+
+// GetDeliveryDeathCount tells how many times a repo request was dead lettered
+// by failures. Expirations of delays are not failures, so they are skipped.
 func GetDeliveryDeathCount(msg *amqp091.Delivery) int64 {
-	if deathInfos, ok := msg.Headers["x-death"].([]interface{}); ok && len(deathInfos) > 0 {
-		if deathInfo, ok := deathInfos[0].(amqp091.Table); ok {
-			if deathCount, ok := deathInfo["count"].(int64); ok {
-				return deathCount
-			}
+	delayedQueue := delayedQueueName(GetDeliveryLane(msg))
+
+	var count int64
+	deathInfos, _ := msg.Headers["x-death"].([]interface{})
+
+	for _, info := range deathInfos {
+		deathInfo, ok := info.(amqp091.Table)
+		if !ok || deathInfo["queue"] == delayedQueue {
+			continue
+		}
+
+		if deathCount, ok := deathInfo["count"].(int64); ok && deathCount > count {
+			count = deathCount
 		}
 	}
 
-	return 0
+	return count
 }
@@ -0,0 +1,119 @@
+package mq_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lesnoi-kot/versions-backend/mq"
+	"github.com/nats-io/nats.go"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestAMQPDeliveryRetries(t *testing.T) {
+	queue := mq.LaneInteractive.QueueName()
+
+	type testCase struct {
+		name    string
+		headers amqp.Table
+		retries int
+	}
+
+	testCases := []testCase{
+		{"new", nil, 0},
+		{"retried", amqp.Table{"x-retry-count": int32(2)}, 2},
+		{"delayed after retries", amqp.Table{
+			"x-retry-count": int32(2),
+			"x-death":       []interface{}{amqp.Table{"queue": queue + "-delayed", "count": int64(1)}},
+		}, 2},
+		{"delayed many times", amqp.Table{
+			"x-death": []interface{}{
+				amqp.Table{"queue": queue + "-delayed", "count": int64(5)},
+				amqp.Table{"queue": queue + "-retry-30s", "count": int64(3)},
+			},
+		}, 3},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			msg := amqp.Delivery{RoutingKey: queue, Headers: test.headers}
+
+			if retries := mq.NewAMQPDelivery(msg).Retries(); retries != test.retries {
+				t.Errorf("Retries did not match: %d != %d", retries, test.retries)
+			}
+		})
+	}
+}
+
+func TestAMQPDeliveryDelayKeepsRetries(t *testing.T) {
+	msg := amqp.Delivery{
+		RoutingKey: mq.LaneBackground.QueueName(),
+		Headers:    amqp.Table{"x-retry-count": int32(4)},
+	}
+
+	delayed := mq.DelayedPublishing(msg, time.Minute)
+
+	if delayed.Headers["x-retry-count"] != int32(4) {
+		t.Errorf("Retry count is not kept: %v", delayed.Headers)
+	}
+	if delayed.Expiration != "60000" {
+		t.Errorf("Unexpected expiration %s", delayed.Expiration)
+	}
+}
+
+func TestNATSDeliveryRetries(t *testing.T) {
+	type testCase struct {
+		name    string
+		headers nats.Header
+		retries int
+		id      string
+	}
+
+	testCases := []testCase{
+		{"new", nats.Header{nats.MsgIdHdr: {"1"}}, 0, "1"},
+		{"retried", nats.Header{"x-retry-count": {"2"}, "x-message-id": {"1"}}, 2, "1"},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			delivery := mq.NewNATSDelivery(&nats.Msg{Header: test.headers})
+
+			if retries := delivery.Retries(); retries != test.retries {
+				t.Errorf("Retries did not match: %d != %d", retries, test.retries)
+			}
+			if id := delivery.MessageID(); id != test.id {
+				t.Errorf("Message ID did not match: %s != %s", id, test.id)
+			}
+		})
+	}
+}
+
+func TestNATSRetryWait(t *testing.T) {
+	retryAt := time.Now().Add(time.Minute).UTC().Format(time.RFC3339Nano)
+
+	if wait := mq.NATSRetryWait(&nats.Msg{Header: nats.Header{"x-retry-at": {retryAt}}}); wait <= 0 || wait > time.Minute {
+		t.Errorf("Unexpected wait of a retried request: %s", wait)
+	}
+	if wait := mq.NATSRetryWait(&nats.Msg{Header: nats.Header{}}); wait != 0 {
+		t.Errorf("New request is held back for %s", wait)
+	}
+}
+
+func TestToNATSParkedMessage(t *testing.T) {
+	parked := mq.ToNATSParkedMessage(&nats.RawStreamMsg{
+		Subject: mq.ParkingLotQueueName,
+		Header: nats.Header{
+			"x-message-id":    {"1"},
+			"x-parked-reason": {"broken"},
+			"x-parked-queue":  {mq.LaneBackground.QueueName()},
+			"x-parked-at":     {"2023-05-01T10:00:00Z"},
+		},
+		Data: []byte("{}"),
+	})
+
+	if parked.ID != "1" || parked.Reason != "broken" || parked.Queue != mq.LaneBackground.QueueName() || parked.Body != "{}" {
+		t.Errorf("Unexpected parked message: %+v", parked)
+	}
+	if !parked.ParkedAt.Equal(time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected parking time %s", parked.ParkedAt)
+	}
+}
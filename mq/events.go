@@ -0,0 +1,124 @@
+package mq
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// EventsExchangeName is the topic exchange of domain events. Events are routed
+// by RoutingKey, so consumers may bind to a repository, an owner or any source
+// with "github.#".
+const EventsExchangeName = "source-events"
+
+// EventSchemaVersion is increased on incompatible changes of Event.
+const EventSchemaVersion = 1
+
+const (
+	EventReleaseCreated = "release.created"
+	EventSourceUpdated  = "source.updated"
+)
+
+// Event is a domain event published to other services. Its ID is derived from
+// the change it announces, so the same change always yields the same ID.
+//
+// An event published again after a relay failure keeps its ID, which is also
+// the AMQP message ID and the NATS message ID. The NATS stream drops such
+// copies, consumers of RabbitMQ must deduplicate events by the ID.
+type Event struct {
+	SchemaVersion int           `json:"schemaVersion"`
+	ID            string        `json:"id"`
+	Type          string        `json:"type"`
+	OccurredAt    time.Time     `json:"occurredAt"`
+	Source        EventSource   `json:"source"`
+	Release       *EventRelease `json:"release,omitempty"`
+
+	// ReleasesAdded is the number of releases added by a source update.
+	ReleasesAdded int `json:"releasesAdded,omitempty"`
+}
+
+type EventSource struct {
+	ID    string `json:"id"`
+	Owner string `json:"owner"`
+	Repo  string `json:"repo"`
+}
+
+type EventRelease struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	TagName     string    `json:"tagName"`
+	URL         string    `json:"url"`
+	PublishedAt time.Time `json:"publishedAt"`
+	IsSemver    bool      `json:"isSemver"`
+}
+
+func NewReleaseCreatedEvent(source EventSource, release EventRelease) *Event {
+	return &Event{
+		SchemaVersion: EventSchemaVersion,
+		ID:            eventID(EventReleaseCreated, source.ID, release.ID),
+		Type:          EventReleaseCreated,
+		OccurredAt:    time.Now().UTC(),
+		Source:        source,
+		Release:       &release,
+	}
+}
+
+// NewSourceUpdatedEvent announces releases added to the source. The end cursor
+// of the update tells it apart from other updates of the source.
+func NewSourceUpdatedEvent(source EventSource, endCursor string, releasesAdded int) *Event {
+	return &Event{
+		SchemaVersion: EventSchemaVersion,
+		ID:            eventID(EventSourceUpdated, source.ID, endCursor),
+		Type:          EventSourceUpdated,
+		OccurredAt:    time.Now().UTC(),
+		Source:        source,
+		ReleasesAdded: releasesAdded,
+	}
+}
+
+func eventID(parts ...string) string {
+	hash := sha256.Sum256([]byte(strings.Join(parts, "/")))
+	return hex.EncodeToString(hash[:16])
+}
+
+// RoutingKey is "github.<owner>.<repo>". Dots of repository names are replaced
+// with underscores, since dots separate words of routing keys.
+func (event *Event) RoutingKey() string {
+	return "github." + event.Source.Owner + "." + strings.ReplaceAll(event.Source.Repo, ".", "_")
+}
+
+// declareEventsExchange declares the topic exchange of domain events.
+func declareEventsExchange(ch *amqp.Channel) error {
+	return ch.ExchangeDeclare(
+		EventsExchangeName,
+		"topic",
+		true,  // durable
+		false, // autoDelete
+		false, // internal
+		false, // noWait
+		nil,
+	)
+}
+
+// PublishEvent publishes the event to the events exchange and waits until the
+// broker confirms it. Events which no queue is bound to are dropped.
+func (conn *AMQPConnection) PublishEvent(ctx context.Context, event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return conn.publishTo(ctx, EventsExchangeName, event.RoutingKey(), false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    event.ID,
+		Type:         event.Type,
+		Timestamp:    event.OccurredAt,
+		Body:         body,
+	})
+}
@@ -0,0 +1,25 @@
+package mq_test
+
+import (
+	"testing"
+
+	"github.com/lesnoi-kot/versions-backend/mq"
+)
+
+func TestEvents(t *testing.T) {
+	source := mq.EventSource{ID: "1", Owner: "socketio", Repo: "socket.io"}
+	release := mq.EventRelease{ID: "2", TagName: "v1.0.0"}
+
+	event := mq.NewReleaseCreatedEvent(source, release)
+	if again := mq.NewReleaseCreatedEvent(source, release); again.ID != event.ID {
+		t.Errorf("Event IDs of the same release differ: %s %s", event.ID, again.ID)
+	}
+
+	if updated := mq.NewSourceUpdatedEvent(source, "cursor", 1); updated.ID == event.ID {
+		t.Errorf("Events of different types have the same ID %s", event.ID)
+	}
+
+	if key := event.RoutingKey(); key != "github.socketio.socket_io" {
+		t.Errorf("Unexpected routing key %s", key)
+	}
+}
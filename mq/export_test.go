@@ -0,0 +1,29 @@
+package mq
+
+import (
+	"time"
+
+	"github.com/nats-io/nats.go"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var (
+	NATSRetryWait       = natsRetryWait
+	ToNATSParkedMessage = toNATSParkedMessage
+)
+
+// NewAMQPDelivery wraps the delivery for tests which do not settle it.
+func NewAMQPDelivery(msg amqp.Delivery) Delivery {
+	return &amqpDelivery{msg: msg}
+}
+
+// DelayedPublishing returns the publishing of the delivery to the delayed
+// queue.
+func DelayedPublishing(msg amqp.Delivery, delay time.Duration) amqp.Publishing {
+	return (&amqpDelivery{msg: msg}).delayed(delay)
+}
+
+// NewNATSDelivery wraps the message for tests which do not settle it.
+func NewNATSDelivery(msg *nats.Msg) Delivery {
+	return &natsDelivery{msg: msg}
+}
@@ -0,0 +1,169 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/lesnoi-kot/versions-backend/tracing"
+)
+
+// memoryLaneCapacity is the number of requests a lane holds before pushing
+// blocks.
+const memoryLaneCapacity = 1000
+
+// MemoryQueue keeps repo requests in the process. Requests are lost on exit,
+// so it suits tests and single process deployments.
+type MemoryQueue struct {
+	lanes     map[Lane]chan Delivery
+	connected chan struct{}
+
+	mu     sync.Mutex
+	parked []*ParkedMessage
+}
+
+func NewMemoryQueue() *MemoryQueue {
+	queue := &MemoryQueue{
+		lanes:     make(map[Lane]chan Delivery, len(lanes)),
+		connected: make(chan struct{}),
+	}
+
+	for _, lane := range lanes {
+		queue.lanes[lane] = make(chan Delivery, memoryLaneCapacity)
+	}
+	close(queue.connected)
+
+	return queue
+}
+
+func (queue *MemoryQueue) PushRepoRequest(ctx context.Context, lane Lane, req *GithubRepoRequestMessage) (err error) {
+	ctx, span := startPublishSpan(ctx, lane, req)
+	defer func() { tracing.EndSpan(span, err) }()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	return queue.push(ctx, &memoryDelivery{
+		queue:        queue,
+		lane:         lane,
+		body:         body,
+		messageID:    req.DeduplicationID,
+		traceContext: tracing.Inject(ctx),
+	})
+}
+
+func (queue *MemoryQueue) push(ctx context.Context, d *memoryDelivery) error {
+	select {
+	case queue.lanes[d.lane] <- d:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pushAfter pushes the request once the delay passes.
+func (queue *MemoryQueue) pushAfter(d *memoryDelivery, delay time.Duration) {
+	time.AfterFunc(delay, func() {
+		queue.push(context.Background(), d)
+	})
+}
+
+// PublishEvent drops the event, since there are no consumers of events in the
+// process.
+func (queue *MemoryQueue) PublishEvent(ctx context.Context, event *Event) error {
+	return nil
+}
+
+// Consume shares the lane between consumers. The channel is never closed.
+func (queue *MemoryQueue) Consume(ctx context.Context, lane Lane) (<-chan Delivery, error) {
+	return queue.lanes[lane], nil
+}
+
+// Parked returns requests of the parking lot.
+func (queue *MemoryQueue) Parked() []*ParkedMessage {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	return append([]*ParkedMessage{}, queue.parked...)
+}
+
+func (queue *MemoryQueue) IsConnected() bool {
+	return true
+}
+
+func (queue *MemoryQueue) Connected() <-chan struct{} {
+	return queue.connected
+}
+
+func (queue *MemoryQueue) Close() error {
+	return nil
+}
+
+type memoryDelivery struct {
+	queue        *MemoryQueue
+	lane         Lane
+	body         []byte
+	messageID    string
+	retries      int
+	traceContext map[string]string
+}
+
+func (d *memoryDelivery) Lane() Lane {
+	return d.lane
+}
+
+func (d *memoryDelivery) Body() []byte {
+	return d.body
+}
+
+func (d *memoryDelivery) MessageID() string {
+	return d.messageID
+}
+
+func (d *memoryDelivery) Context(ctx context.Context) context.Context {
+	return tracing.Extract(ctx, d.traceContext)
+}
+
+func (d *memoryDelivery) Retries() int {
+	return d.retries
+}
+
+func (d *memoryDelivery) Ack() error {
+	return nil
+}
+
+func (d *memoryDelivery) Requeue() error {
+	d.queue.pushAfter(d, 0)
+	return nil
+}
+
+func (d *memoryDelivery) Retry(ctx context.Context) error {
+	retried := *d
+	retried.retries++
+
+	d.queue.pushAfter(&retried, retryTierOf(retried.retries).delay)
+	return nil
+}
+
+func (d *memoryDelivery) Delay(ctx context.Context, delay time.Duration) error {
+	d.queue.pushAfter(d, delay)
+	return nil
+}
+
+func (d *memoryDelivery) Park(ctx context.Context, reason string) error {
+	d.queue.mu.Lock()
+	defer d.queue.mu.Unlock()
+
+	d.queue.parked = append(d.queue.parked, &ParkedMessage{
+		ID:       d.messageID,
+		Reason:   reason,
+		Queue:    d.lane.QueueName(),
+		ParkedAt: time.Now(),
+		Body:     string(d.body),
+	})
+
+	return nil
+}
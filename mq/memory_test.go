@@ -0,0 +1,59 @@
+package mq_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lesnoi-kot/versions-backend/mq"
+)
+
+func TestMemoryQueue(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	queue := mq.NewMemoryQueue()
+
+	err := queue.PushRepoRequest(ctx, mq.LaneBackground, &mq.GithubRepoRequestMessage{
+		Owner:           "a",
+		Repo:            "b",
+		DeduplicationID: "1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries, err := queue.Consume(ctx, mq.LaneBackground)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msg mq.Delivery
+	select {
+	case msg = <-deliveries:
+	case <-ctx.Done():
+		t.Fatal("Request is not delivered")
+	}
+
+	if msg.Lane() != mq.LaneBackground || msg.MessageID() != "1" || msg.Retries() != 0 {
+		t.Errorf("Unexpected delivery: %s %s %d", msg.Lane(), msg.MessageID(), msg.Retries())
+	}
+
+	if err := msg.Delay(ctx, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case msg = <-deliveries:
+	case <-ctx.Done():
+		t.Fatal("Delayed request is not delivered")
+	}
+
+	if err := msg.Park(ctx, "broken"); err != nil {
+		t.Fatal(err)
+	}
+
+	if parked := queue.Parked(); len(parked) != 1 || parked[0].Reason != "broken" || parked[0].ID != "1" {
+		t.Errorf("Request is not parked: %+v", parked)
+	}
+}
@@ -3,39 +3,174 @@ package mq
 import (
 	"context"
 	"encoding/json"
+	"sync"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+
+	"github.com/lesnoi-kot/versions-backend/tracing"
+)
+
+const (
+	// Requests rejected by lane queues are dead lettered to the rejections
+	// exchange. It forwards them to the first retry tier of their lane.
+	rejectionsExchangeName     = "dlx-source-requests"
+	rejectionRetryExchangeName = "dlx-source-requests-retry"
+
+	// legacyRetryQueueName is the queue where rejected requests of every lane
+	// waited for an hour before the retry tiers.
+	legacyRetryQueueName = "dlq-source-requests"
+
+	retryCountHeader = "x-retry-count"
 )
 
+type retryTier struct {
+	name  string
+	delay time.Duration
+}
+
+// retryTiers are delays of retried repo requests by the number of the retry.
+// Later retries wait in the last tier.
+var retryTiers = []retryTier{
+	{"30s", 30 * time.Second},
+	{"5m", 5 * time.Minute},
+	{"30m", 30 * time.Minute},
+	{"2h", 2 * time.Hour},
+}
+
+// Lane is a queue of repo requests. Interactive requests are made by users
+// waiting for the result, background ones by imports and maintenance.
+type Lane string
+
 const (
-	retriesExchangeName = "dlx-source-requests"
-	retryDelay          = 1 * time.Hour
+	LaneInteractive Lane = "interactive"
+	LaneBackground  Lane = "background"
 )
 
+var lanes = []Lane{LaneInteractive, LaneBackground}
+
+func (lane Lane) QueueName() string {
+	if lane == LaneBackground {
+		return "source-requests-background"
+	}
+
+	return "source-requests"
+}
+
+// AMQPConnection reconnects to the broker when the connection is lost.
 type AMQPConnection struct {
-	*amqp.Connection
+	uri string
+
+	mu        sync.RWMutex
+	conn      *amqp.Connection
+	connected chan struct{} // Closed while the connection is up.
+	closed    bool
+
+	// Idle channels in confirm mode used for publishing.
+	publishers chan *publisher
 }
 
+// NewAMQPConnection connects to the broker and declares the topology of repo
+// requests.
 func NewAMQPConnection(amqpURI string) (*AMQPConnection, error) {
-	conn, err := amqp.Dial(amqpURI)
+	conn := &AMQPConnection{
+		uri:        amqpURI,
+		connected:  make(chan struct{}),
+		publishers: make(chan *publisher, publisherPoolSize),
+	}
+
+	closes, err := conn.connect()
 	if err != nil {
 		return nil, err
 	}
 
-	return &AMQPConnection{conn}, nil
+	go conn.reconnectOnClose(closes)
+	return conn, nil
+}
+
+// declareTopology declares queues of every lane along with their retry,
+// delayed and parking lot queues, and the events exchange.
+func declareTopology(conn *amqp.Connection) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+
+	defer ch.Close()
+
+	for _, lane := range lanes {
+		if _, err := DeclareRepoRequestsQueue(ch, lane); err != nil {
+			return err
+		}
+		if _, err := declareDelayedRepoRequestsQueue(ch, lane); err != nil {
+			return err
+		}
+		for retry := 1; retry <= len(retryTiers); retry++ {
+			if _, err := declareRetryQueue(ch, lane, retry); err != nil {
+				return err
+			}
+		}
+		if err := ch.QueueBind(retryQueueName(lane, 1), lane.QueueName(), rejectionRetryExchangeName, false, nil); err != nil {
+			return err
+		}
+	}
+
+	if _, err := DeclareParkingLotQueue(ch); err != nil {
+		return err
+	}
+
+	retireLegacyRetryQueue(conn)
+
+	return declareEventsExchange(ch)
+}
+
+// retireLegacyRetryQueue unbinds the legacy retry queue, so requests left in
+// it return to their lanes, and deletes it once it is empty. A failed step
+// closes its channel, so every step takes its own one and failures, such as a
+// missing queue, are ignored.
+func retireLegacyRetryQueue(conn *amqp.Connection) {
+	steps := []func(ch *amqp.Channel) error{
+		func(ch *amqp.Channel) error {
+			return ch.QueueUnbind(legacyRetryQueueName, "", rejectionsExchangeName, nil)
+		},
+		func(ch *amqp.Channel) error {
+			_, err := ch.QueueDelete(legacyRetryQueueName, false, true, false)
+			return err
+		},
+	}
+
+	for _, step := range steps {
+		ch, err := conn.Channel()
+		if err != nil {
+			return
+		}
+
+		step(ch)
+		ch.Close()
+	}
 }
 
 // Message format of a repo request.
 type GithubRepoRequestMessage struct {
-	Owner string `json:"owner"`
-	Repo  string `json:"repo"`
+	Owner    string `json:"owner"`
+	Repo     string `json:"repo"`
+	SourceID string `json:"sourceId,omitempty"`
+	JobID    string `json:"jobId,omitempty"`
+
+	// DeduplicationID is unique per request, redeliveries and republishing of
+	// the message keep it. It is also the AMQP message ID.
+	DeduplicationID string `json:"deduplicationId,omitempty"`
 }
 
-func DeclareRepoRequestsQueue(ch *amqp.Channel) (amqp.Queue, error) {
-	// Dead letter exchange for rejected requests.
+// DeclareRepoRequestsQueue declares the queue of the lane. Rejected requests
+// keep the lane queue name as the routing key, so the rejections exchange
+// forwards them to the first retry tier of the lane.
+func DeclareRepoRequestsQueue(ch *amqp.Channel, lane Lane) (amqp.Queue, error) {
+	// The fanout exchange is kept, since lane queues of earlier deployments
+	// dead letter to it and queue arguments can not be changed.
 	err := ch.ExchangeDeclare(
-		retriesExchangeName,
+		rejectionsExchangeName,
 		"fanout",
 		true,  // durable
 		false, // autoDelete
@@ -47,81 +182,168 @@ func DeclareRepoRequestsQueue(ch *amqp.Channel) (amqp.Queue, error) {
 		return amqp.Queue{}, err
 	}
 
-	retryQueue, err := ch.QueueDeclare(
-		"dlq-source-requests",
+	err = ch.ExchangeDeclare(
+		rejectionRetryExchangeName,
+		"direct",
 		true,  // durable
 		false, // autoDelete
-		false, // exclusive
+		false, // internal
 		false, // noWait
-		amqp.Table{
-			"x-dead-letter-exchange": "", // Return message to the default exchange
-			"x-message-ttl":          retryDelay.Milliseconds(),
-		},
+		nil,
 	)
 	if err != nil {
 		return amqp.Queue{}, err
 	}
 
-	if err = ch.QueueBind(retryQueue.Name, "", retriesExchangeName, false, nil); err != nil {
+	if err = ch.ExchangeBind(rejectionRetryExchangeName, "", rejectionsExchangeName, false, nil); err != nil {
 		return amqp.Queue{}, err
 	}
 
 	return ch.QueueDeclare(
-		"source-requests",
+		lane.QueueName(),
 		true,  // durable
 		false, // autoDelete
 		false, // exclusive
 		false, // noWait
 		amqp.Table{
-			"x-dead-letter-exchange": retriesExchangeName,
+			"x-dead-letter-exchange": rejectionsExchangeName,
 		},
 	)
 }
 
-func ConsumeRepoRequestsQueue(ch *amqp.Channel) (<-chan amqp.Delivery, error) {
-	q, err := DeclareRepoRequestsQueue(ch)
-	if err != nil {
+// declareDelayedRepoRequestsQueue declares the queue where requests of the
+// lane wait until their expiration and then return to the lane queue. Messages
+// expire in order, so a delay should not be much longer than the earlier ones.
+func declareDelayedRepoRequestsQueue(ch *amqp.Channel, lane Lane) (amqp.Queue, error) {
+	return ch.QueueDeclare(
+		delayedQueueName(lane),
+		true,  // durable
+		false, // autoDelete
+		false, // exclusive
+		false, // noWait
+		amqp.Table{
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": lane.QueueName(),
+		},
+	)
+}
+
+// declareRetryQueue declares the queue where requests of the lane wait for the
+// retry tier delay and then return to the lane queue.
+func declareRetryQueue(ch *amqp.Channel, lane Lane, retry int) (amqp.Queue, error) {
+	tier := retryTierOf(retry)
+
+	return ch.QueueDeclare(
+		retryQueueName(lane, retry),
+		true,  // durable
+		false, // autoDelete
+		false, // exclusive
+		false, // noWait
+		amqp.Table{
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": lane.QueueName(),
+			"x-message-ttl":             tier.delay.Milliseconds(),
+		},
+	)
+}
+
+func delayedQueueName(lane Lane) string {
+	return lane.QueueName() + "-delayed"
+}
+
+func retryTierOf(retry int) retryTier {
+	if retry > len(retryTiers) {
+		return retryTiers[len(retryTiers)-1]
+	}
+
+	return retryTiers[retry-1]
+}
+
+func retryQueueName(lane Lane, retry int) string {
+	return lane.QueueName() + "-retry-" + retryTierOf(retry).name
+}
+
+// ConsumeRepoRequestsQueue consumes the lane queue one message at a time, so
+// messages of other lanes are not held by a busy consumer.
+func ConsumeRepoRequestsQueue(ch *amqp.Channel, lane Lane) (<-chan amqp.Delivery, error) {
+	if err := ch.Qos(1, 0, false); err != nil {
 		return nil, err
 	}
 
 	msgs, err := ch.Consume(
-		q.Name, // queue
-		"",     // consumer
-		false,  // auto-ack
-		false,  // exclusive
-		false,  // no-local
-		false,  // no-wait
-		nil,    // args
+		lane.QueueName(), // queue
+		"",               // consumer
+		false,            // auto-ack
+		false,            // exclusive
+		false,            // no-local
+		false,            // no-wait
+		nil,              // args
 	)
 
 	return msgs, err
 }
 
-func (conn *AMQPConnection) PushRepoRequest(ctx context.Context, req *GithubRepoRequestMessage) error {
-	ch, err := conn.Channel()
+// PushRepoRequest publishes the request with the trace context of ctx in its
+// headers.
+func (conn *AMQPConnection) PushRepoRequest(ctx context.Context, lane Lane, req *GithubRepoRequestMessage) (err error) {
+	ctx, span := startPublishSpan(ctx, lane, req)
+	defer func() { tracing.EndSpan(span, err) }()
+
+	body, err := json.Marshal(req)
 	if err != nil {
 		return err
 	}
 
-	q, err := DeclareRepoRequestsQueue(ch)
+	headers := amqp.Table{}
+	otel.GetTextMapPropagator().Inject(ctx, amqpHeaderCarrier(headers))
+
+	return conn.publish(ctx, lane.QueueName(), amqp.Publishing{
+		Headers:      headers,
+		ContentType:  "text/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    req.DeduplicationID,
+		Body:         body,
+	})
+}
+
+// Consume consumes the lane queue with its own channel, which is closed when
+// the context is done.
+func (conn *AMQPConnection) Consume(ctx context.Context, lane Lane) (<-chan Delivery, error) {
+	ch, err := conn.Channel()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	body, err := json.Marshal(req)
+	msgs, err := ConsumeRepoRequestsQueue(ch, lane)
 	if err != nil {
-		return err
+		ch.Close()
+		return nil, err
 	}
 
-	return ch.PublishWithContext(
-		ctx,
-		"",     // exchange
-		q.Name, // key
-		false,  // mandatory
-		false,  // immediate
-		amqp.Publishing{
-			ContentType: "text/json",
-			Body:        body,
-		},
-	)
+	deliveries := make(chan Delivery)
+
+	go func() {
+		defer close(deliveries)
+		defer ch.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+
+				select {
+				case deliveries <- &amqpDelivery{conn: conn, msg: msg}:
+				case <-ctx.Done():
+					msg.Nack(false, true)
+					return
+				}
+			}
+		}
+	}()
+
+	return deliveries, nil
 }
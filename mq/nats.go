@@ -0,0 +1,512 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/lesnoi-kot/versions-backend/tracing"
+)
+
+const (
+	natsStreamName       = "SOURCE_REQUESTS"
+	natsEventsStreamName = "SOURCE_EVENTS"
+
+	// natsAckWait is how long a request is handled before it is redelivered.
+	natsAckWait = 10 * time.Minute
+
+	// natsFetchWait bounds a pull, so consuming notices the context is done.
+	natsFetchWait = 5 * time.Second
+
+	// natsEventsDuplicates is the window in which the events stream drops an
+	// event published again with the same ID. It outlasts the claim of an
+	// event by the relay many times over.
+	natsEventsDuplicates = 1 * time.Hour
+
+	// natsMessageIDHeader keeps the ID of a request published again, since the
+	// stream would discard it as a duplicate by its original ID.
+	natsMessageIDHeader = "x-message-id"
+
+	// natsRetryAtHeader holds a retried request back until its backoff passes.
+	natsRetryAtHeader = "x-retry-at"
+)
+
+// NATSQueue keeps repo requests in a JetStream stream with a subject per lane
+// and the parking lot. Retries are published again with the retry count in a
+// header, while delays and requeues are negative acknowledgements, so only
+// failures are counted.
+type NATSQueue struct {
+	nc *nats.Conn
+	js nats.JetStreamContext
+
+	mu        sync.RWMutex
+	connected chan struct{} // Closed while the connection is up.
+}
+
+func NewNATSQueue(uri string) (*NATSQueue, error) {
+	queue := &NATSQueue{connected: make(chan struct{})}
+
+	nc, err := nats.Connect(
+		uri,
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(queue.onDisconnect),
+		nats.ReconnectHandler(queue.onReconnect),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := nc.JetStream()
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	subjects := []string{ParkingLotQueueName}
+	for _, lane := range lanes {
+		subjects = append(subjects, lane.QueueName())
+	}
+
+	// Parked requests are read by sequence without a consumer, which needs
+	// direct gets.
+	err = ensureNATSStream(js, &nats.StreamConfig{
+		Name:        natsStreamName,
+		Subjects:    subjects,
+		Retention:   nats.WorkQueuePolicy,
+		Storage:     nats.FileStorage,
+		AllowDirect: true,
+	})
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	// Durable consumers are shared by dataloaders and outlive their
+	// subscriptions.
+	for _, lane := range lanes {
+		_, err = js.AddConsumer(natsStreamName, &nats.ConsumerConfig{
+			Durable:       natsConsumerName(lane),
+			FilterSubject: lane.QueueName(),
+			AckPolicy:     nats.AckExplicitPolicy,
+			AckWait:       natsAckWait,
+		})
+		if err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+
+	err = ensureNATSStream(js, &nats.StreamConfig{
+		Name:       natsEventsStreamName,
+		Subjects:   []string{EventsExchangeName + ".>"},
+		Storage:    nats.FileStorage,
+		Duplicates: natsEventsDuplicates,
+	})
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	queue.nc, queue.js = nc, js
+	close(queue.connected)
+
+	return queue, nil
+}
+
+// ensureNATSStream adds the stream or updates it if it was created with
+// another config, e.g. before a lane was added.
+func ensureNATSStream(js nats.JetStreamContext, config *nats.StreamConfig) error {
+	info, err := js.StreamInfo(config.Name)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = js.AddStream(config)
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	if natsStreamConfigMatches(&info.Config, config) {
+		return nil
+	}
+
+	log.Info().Str("stream", config.Name).Msg("Updating NATS stream config")
+	_, err = js.UpdateStream(config)
+	return err
+}
+
+// natsStreamConfigMatches compares the fields of the config set by the queue,
+// others are filled with defaults by the server.
+func natsStreamConfigMatches(current, wanted *nats.StreamConfig) bool {
+	sortedSubjects := func(subjects []string) []string {
+		sorted := append([]string(nil), subjects...)
+		sort.Strings(sorted)
+		return sorted
+	}
+
+	return reflect.DeepEqual(sortedSubjects(current.Subjects), sortedSubjects(wanted.Subjects)) &&
+		current.Retention == wanted.Retention &&
+		current.Storage == wanted.Storage &&
+		current.AllowDirect == wanted.AllowDirect &&
+		(wanted.Duplicates == 0 || current.Duplicates == wanted.Duplicates)
+}
+
+func (queue *NATSQueue) onDisconnect(nc *nats.Conn, err error) {
+	log.Error().Err(err).Msg("NATS connection is lost, reconnecting")
+
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	select {
+	case <-queue.connected:
+		queue.connected = make(chan struct{})
+	default:
+	}
+}
+
+func (queue *NATSQueue) onReconnect(nc *nats.Conn) {
+	log.Info().Msg("NATS connection is restored")
+
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	select {
+	case <-queue.connected:
+	default:
+		close(queue.connected)
+	}
+}
+
+// PushRepoRequest waits until the stream stores the request. Requests with the
+// same deduplication ID are stored once within the stream duplicates window.
+func (queue *NATSQueue) PushRepoRequest(ctx context.Context, lane Lane, req *GithubRepoRequestMessage) (err error) {
+	ctx, span := startPublishSpan(ctx, lane, req)
+	defer func() { tracing.EndSpan(span, err) }()
+
+	msg := nats.NewMsg(lane.QueueName())
+	if msg.Data, err = json.Marshal(req); err != nil {
+		return err
+	}
+
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(msg.Header))
+
+	opts := []nats.PubOpt{nats.Context(ctx)}
+	if req.DeduplicationID != "" {
+		opts = append(opts, nats.MsgId(req.DeduplicationID))
+	}
+
+	_, err = queue.js.PublishMsg(msg, opts...)
+	return err
+}
+
+// PublishEvent publishes the event to the events stream with the subject
+// "source-events.<routing key>". The stream stores an event published again
+// within the duplicates window once.
+func (queue *NATSQueue) PublishEvent(ctx context.Context, event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = queue.js.Publish(
+		EventsExchangeName+"."+event.RoutingKey(),
+		body,
+		nats.Context(ctx),
+		nats.MsgId(event.ID),
+	)
+	return err
+}
+
+// Consume pulls requests of the lane with the durable consumer shared by every
+// dataloader. The consumer is bound, so unsubscribing does not delete it.
+func (queue *NATSQueue) Consume(ctx context.Context, lane Lane) (<-chan Delivery, error) {
+	sub, err := queue.js.PullSubscribe(
+		lane.QueueName(),
+		natsConsumerName(lane),
+		nats.Bind(natsStreamName, natsConsumerName(lane)),
+		nats.ManualAck(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make(chan Delivery)
+
+	go func() {
+		defer close(deliveries)
+		defer sub.Unsubscribe()
+
+		for {
+			fetchCtx, cancel := context.WithTimeout(ctx, natsFetchWait)
+			msgs, err := sub.Fetch(1, nats.Context(fetchCtx))
+			cancel()
+
+			if ctx.Err() != nil {
+				return
+			} else if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, nats.ErrTimeout) {
+				continue
+			} else if err != nil {
+				log.Error().Err(err).Msg("NATS fetch error")
+				return
+			}
+
+			for _, msg := range msgs {
+				// Retried requests wait out their backoff in the stream.
+				if wait := natsRetryWait(msg); wait > 0 {
+					msg.NakWithDelay(wait)
+					continue
+				}
+
+				select {
+				case deliveries <- &natsDelivery{queue: queue, lane: lane, msg: msg}:
+				case <-ctx.Done():
+					msg.Nak()
+					return
+				}
+			}
+		}
+	}()
+
+	return deliveries, nil
+}
+
+func natsConsumerName(lane Lane) string {
+	return "dataloader-" + string(lane)
+}
+
+// natsRetryWait tells how long the retried request is held back.
+func natsRetryWait(msg *nats.Msg) time.Duration {
+	retryAt, err := time.Parse(time.RFC3339Nano, msg.Header.Get(natsRetryAtHeader))
+	if err != nil {
+		return 0
+	}
+
+	return time.Until(retryAt)
+}
+
+func (queue *NATSQueue) IsConnected() bool {
+	return queue.nc.IsConnected()
+}
+
+func (queue *NATSQueue) Connected() <-chan struct{} {
+	queue.mu.RLock()
+	defer queue.mu.RUnlock()
+
+	return queue.connected
+}
+
+func (queue *NATSQueue) Close() error {
+	queue.nc.Close()
+	return nil
+}
+
+type natsDelivery struct {
+	queue *NATSQueue
+	lane  Lane
+	msg   *nats.Msg
+}
+
+func (d *natsDelivery) Lane() Lane {
+	return d.lane
+}
+
+func (d *natsDelivery) Body() []byte {
+	return d.msg.Data
+}
+
+func (d *natsDelivery) MessageID() string {
+	if id := d.msg.Header.Get(nats.MsgIdHdr); id != "" {
+		return id
+	}
+
+	return d.msg.Header.Get(natsMessageIDHeader)
+}
+
+func (d *natsDelivery) Context(ctx context.Context) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(d.msg.Header))
+}
+
+// Retries counts failures only. Redeliveries of delays, requeues and expired
+// acks are not counted.
+func (d *natsDelivery) Retries() int {
+	retries, _ := strconv.Atoi(d.msg.Header.Get(retryCountHeader))
+	return retries
+}
+
+func (d *natsDelivery) Ack() error {
+	return d.msg.Ack()
+}
+
+func (d *natsDelivery) Requeue() error {
+	return d.msg.Nak()
+}
+
+// Retry publishes the request again with the next retry count, since a
+// redelivery can not change headers. The request is redelivered after the
+// backoff if publishing fails.
+func (d *natsDelivery) Retry(ctx context.Context) error {
+	retry := d.Retries() + 1
+	delay := retryTierOf(retry).delay
+
+	msg := d.republishing(d.lane.QueueName())
+	msg.Header.Set(retryCountHeader, strconv.Itoa(retry))
+	msg.Header.Set(natsRetryAtHeader, time.Now().Add(delay).UTC().Format(time.RFC3339Nano))
+
+	if _, err := d.queue.js.PublishMsg(msg, nats.Context(ctx)); err != nil {
+		d.msg.NakWithDelay(delay)
+		return err
+	}
+
+	return d.msg.Ack()
+}
+
+func (d *natsDelivery) Delay(ctx context.Context, delay time.Duration) error {
+	return d.msg.NakWithDelay(delay)
+}
+
+// Park publishes the request to the parking lot subject and stops its
+// redelivery.
+func (d *natsDelivery) Park(ctx context.Context, reason string) error {
+	parked := d.republishing(ParkingLotQueueName)
+	if d.MessageID() == "" {
+		parked.Header.Set(natsMessageIDHeader, newMessageID())
+	}
+	if retries := d.Retries(); retries > 0 {
+		parked.Header.Set(retryCountHeader, strconv.Itoa(retries))
+	}
+	parked.Header.Set(parkedReasonHeader, reason)
+	parked.Header.Set(parkedQueueHeader, d.lane.QueueName())
+	parked.Header.Set(parkedAtHeader, time.Now().UTC().Format(time.RFC3339))
+
+	if _, err := d.queue.js.PublishMsg(parked, nats.Context(ctx)); err != nil {
+		return err
+	}
+
+	return d.msg.Term()
+}
+
+// republishing copies the request with its trace context and ID to the
+// subject.
+func (d *natsDelivery) republishing(subject string) *nats.Msg {
+	msg := nats.NewMsg(subject)
+	msg.Data = d.msg.Data
+	for _, field := range otel.GetTextMapPropagator().Fields() {
+		if value := propagation.HeaderCarrier(d.msg.Header).Get(field); value != "" {
+			propagation.HeaderCarrier(msg.Header).Set(field, value)
+		}
+	}
+	msg.Header.Set(natsMessageIDHeader, d.MessageID())
+
+	return msg
+}
+
+// ListParkedRequests returns up to limit messages of the parking lot without
+// removing them. Every message is returned if the limit is negative.
+func (queue *NATSQueue) ListParkedRequests(limit int) ([]*ParkedMessage, error) {
+	var parked []*ParkedMessage
+
+	_, err := queue.takeParkedRequests(func(msg *nats.RawStreamMsg) (bool, error) {
+		if len(parked) == limit {
+			return false, errStopTaking
+		}
+
+		parked = append(parked, toNATSParkedMessage(msg))
+		return false, nil
+	})
+
+	return parked, err
+}
+
+// ReplayParkedRequests publishes the matching messages of the parking lot
+// back to the lanes they came from. Their retries are counted from the
+// beginning.
+func (queue *NATSQueue) ReplayParkedRequests(ctx context.Context, match func(*ParkedMessage) bool) (int, error) {
+	return queue.takeParkedRequests(func(msg *nats.RawStreamMsg) (bool, error) {
+		if !match(toNATSParkedMessage(msg)) {
+			return false, nil
+		}
+
+		subject := msg.Header.Get(parkedQueueHeader)
+		if subject == "" {
+			subject = LaneInteractive.QueueName()
+		}
+
+		replayed := nats.NewMsg(subject)
+		replayed.Data = msg.Data
+		for name, values := range msg.Header {
+			switch name {
+			case parkedReasonHeader, parkedQueueHeader, parkedAtHeader, retryCountHeader, natsRetryAtHeader:
+			default:
+				replayed.Header[name] = values
+			}
+		}
+
+		_, err := queue.js.PublishMsg(replayed, nats.Context(ctx))
+		return err == nil, err
+	})
+}
+
+// PurgeParkedRequests removes the matching messages of the parking lot.
+func (queue *NATSQueue) PurgeParkedRequests(match func(*ParkedMessage) bool) (int, error) {
+	return queue.takeParkedRequests(func(msg *nats.RawStreamMsg) (bool, error) {
+		return match(toNATSParkedMessage(msg)), nil
+	})
+}
+
+// takeParkedRequests visits messages of the parking lot subject in the order
+// they were parked. Messages are deleted from the stream if the visit tells
+// so.
+func (queue *NATSQueue) takeParkedRequests(visit func(*nats.RawStreamMsg) (bool, error)) (int, error) {
+	taken := 0
+
+	for seq := uint64(1); ; {
+		msg, err := queue.js.GetMsg(natsStreamName, seq, nats.DirectGetNext(ParkingLotQueueName))
+		if errors.Is(err, nats.ErrMsgNotFound) {
+			return taken, nil
+		} else if err != nil {
+			return taken, err
+		}
+		seq = msg.Sequence + 1
+
+		take, err := visit(msg)
+		if err == errStopTaking {
+			return taken, nil
+		} else if err != nil {
+			return taken, err
+		}
+		if !take {
+			continue
+		}
+
+		if err := queue.js.DeleteMsg(natsStreamName, msg.Sequence); err != nil {
+			return taken, err
+		}
+		taken++
+	}
+}
+
+func toNATSParkedMessage(msg *nats.RawStreamMsg) *ParkedMessage {
+	parked := &ParkedMessage{
+		ID:      msg.Header.Get(natsMessageIDHeader),
+		Reason:  msg.Header.Get(parkedReasonHeader),
+		Queue:   msg.Header.Get(parkedQueueHeader),
+		Headers: amqp.Table{},
+		Body:    string(msg.Data),
+	}
+
+	parked.ParkedAt, _ = time.Parse(time.RFC3339, msg.Header.Get(parkedAtHeader))
+	for name := range msg.Header {
+		parked.Headers[name] = msg.Header.Get(name)
+	}
+
+	return parked
+}
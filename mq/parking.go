@@ -0,0 +1,200 @@
+package mq
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var errStopTaking = errors.New("stop taking parked messages")
+
+// ParkingLotQueueName is the queue of repo requests which can not be handled.
+// They are kept until replayed or purged by an operator.
+const ParkingLotQueueName = "source-requests-parked"
+
+const (
+	parkedReasonHeader = "x-parked-reason"
+	parkedQueueHeader  = "x-parked-queue"
+	parkedAtHeader     = "x-parked-at"
+)
+
+// ParkingLot lets an operator inspect, replay and purge parked repo requests
+// of a queue backend.
+type ParkingLot interface {
+	ListParkedRequests(limit int) ([]*ParkedMessage, error)
+	ReplayParkedRequests(ctx context.Context, match func(*ParkedMessage) bool) (int, error)
+	PurgeParkedRequests(match func(*ParkedMessage) bool) (int, error)
+	Close() error
+}
+
+var (
+	_ ParkingLot = (*AMQPConnection)(nil)
+	_ ParkingLot = (*NATSQueue)(nil)
+)
+
+// NewParkingLot connects to the parking lot of the backend.
+func NewParkingLot(backend, uri string) (ParkingLot, error) {
+	switch backend {
+	case BackendRabbitMQ:
+		return NewAMQPConnection(uri)
+	case BackendNATS:
+		return NewNATSQueue(uri)
+	case BackendMemory:
+		return nil, ErrMemoryQueueNotShared
+	}
+
+	return nil, fmt.Errorf("unknown queue backend %q", backend)
+}
+
+// ParkedMessage is a repo request of the parking lot with its original
+// headers.
+type ParkedMessage struct {
+	ID       string     `json:"id"`
+	Reason   string     `json:"reason"`
+	Queue    string     `json:"queue"`
+	ParkedAt time.Time  `json:"parkedAt"`
+	Headers  amqp.Table `json:"headers,omitempty"`
+	Body     string     `json:"body"`
+}
+
+func DeclareParkingLotQueue(ch *amqp.Channel) (amqp.Queue, error) {
+	return ch.QueueDeclare(
+		ParkingLotQueueName,
+		true,  // durable
+		false, // autoDelete
+		false, // exclusive
+		false, // noWait
+		nil,
+	)
+}
+
+// ListParkedRequests returns up to limit messages of the parking lot without
+// removing them. Every message is returned if the limit is negative.
+func (conn *AMQPConnection) ListParkedRequests(limit int) ([]*ParkedMessage, error) {
+	var parked []*ParkedMessage
+
+	_, err := conn.takeParkedRequests(func(msg *amqp.Delivery) (bool, error) {
+		if len(parked) == limit {
+			return false, errStopTaking
+		}
+
+		parked = append(parked, toParkedMessage(msg))
+		return false, nil
+	})
+
+	return parked, err
+}
+
+// ReplayParkedRequests pushes the matching messages of the parking lot back to
+// the queues they came from. Their retries are counted from the beginning.
+func (conn *AMQPConnection) ReplayParkedRequests(ctx context.Context, match func(*ParkedMessage) bool) (int, error) {
+	return conn.takeParkedRequests(func(msg *amqp.Delivery) (bool, error) {
+		if !match(toParkedMessage(msg)) {
+			return false, nil
+		}
+
+		queue, _ := msg.Headers[parkedQueueHeader].(string)
+		if queue == "" {
+			queue = LaneInteractive.QueueName()
+		}
+
+		headers := amqp.Table{}
+		for name, value := range msg.Headers {
+			switch name {
+			case parkedReasonHeader, parkedQueueHeader, parkedAtHeader, retryCountHeader, "x-death":
+			default:
+				headers[name] = value
+			}
+		}
+
+		err := conn.publish(ctx, queue, amqp.Publishing{
+			ContentType:  msg.ContentType,
+			DeliveryMode: amqp.Persistent,
+			MessageId:    msg.MessageId,
+			Headers:      headers,
+			Body:         msg.Body,
+		})
+
+		return err == nil, err
+	})
+}
+
+// PurgeParkedRequests removes the matching messages of the parking lot.
+func (conn *AMQPConnection) PurgeParkedRequests(match func(*ParkedMessage) bool) (int, error) {
+	return conn.takeParkedRequests(func(msg *amqp.Delivery) (bool, error) {
+		return match(toParkedMessage(msg)), nil
+	})
+}
+
+// takeParkedRequests visits messages of the parking lot. Messages are removed
+// if the visit tells so, the rest are returned to the queue.
+func (conn *AMQPConnection) takeParkedRequests(visit func(*amqp.Delivery) (bool, error)) (int, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return 0, err
+	}
+
+	defer ch.Close()
+
+	var kept uint64
+	defer func() {
+		if kept > 0 {
+			ch.Nack(kept, true, true)
+		}
+	}()
+
+	taken := 0
+	for {
+		msg, ok, err := ch.Get(ParkingLotQueueName, false)
+		if err != nil {
+			return taken, err
+		} else if !ok {
+			return taken, nil
+		}
+
+		take, err := visit(&msg)
+		if !take {
+			kept = msg.DeliveryTag
+		}
+		if err == errStopTaking {
+			return taken, nil
+		} else if err != nil {
+			return taken, err
+		}
+		if !take {
+			continue
+		}
+
+		if err := msg.Ack(false); err != nil {
+			return taken, err
+		}
+		taken++
+	}
+}
+
+func toParkedMessage(msg *amqp.Delivery) *ParkedMessage {
+	parked := &ParkedMessage{
+		ID:      msg.MessageId,
+		Headers: msg.Headers,
+		Body:    string(msg.Body),
+	}
+
+	parked.Reason, _ = msg.Headers[parkedReasonHeader].(string)
+	parked.Queue, _ = msg.Headers[parkedQueueHeader].(string)
+	if parkedAt, ok := msg.Headers[parkedAtHeader].(string); ok {
+		parked.ParkedAt, _ = time.Parse(time.RFC3339, parkedAt)
+	}
+
+	return parked
+}
+
+func newMessageID() string {
+	id := make([]byte, 12)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
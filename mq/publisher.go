@@ -0,0 +1,120 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// publisherPoolSize is the number of idle publishing channels kept open.
+const publisherPoolSize = 8
+
+var (
+	ErrMessageReturned = errors.New("message is not routed to any queue")
+	ErrMessageNacked   = errors.New("message is not confirmed by the broker")
+)
+
+// publisher is a channel in confirm mode. It publishes one message at a time,
+// so a returned message belongs to the current publishing.
+type publisher struct {
+	ch      *amqp.Channel
+	returns chan amqp.Return
+}
+
+func (conn *AMQPConnection) newPublisher() (*publisher, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	return &publisher{
+		ch:      ch,
+		returns: ch.NotifyReturn(make(chan amqp.Return, 1)),
+	}, nil
+}
+
+func (conn *AMQPConnection) takePublisher() (*publisher, error) {
+	for {
+		select {
+		case pub := <-conn.publishers:
+			if !pub.ch.IsClosed() {
+				return pub, nil
+			}
+		default:
+			return conn.newPublisher()
+		}
+	}
+}
+
+func (conn *AMQPConnection) releasePublisher(pub *publisher) {
+	if pub.ch.IsClosed() {
+		return
+	}
+
+	select {
+	case conn.publishers <- pub:
+	default:
+		pub.ch.Close()
+	}
+}
+
+// publish sends the message to the queue with the default exchange and waits
+// until the broker confirms it.
+func (conn *AMQPConnection) publish(ctx context.Context, queue string, msg amqp.Publishing) error {
+	return conn.publishTo(ctx, "", queue, true, msg)
+}
+
+// publishTo sends the message to the exchange and waits until the broker
+// confirms it. Mandatory messages which are not routed to any queue fail with
+// ErrMessageReturned.
+func (conn *AMQPConnection) publishTo(ctx context.Context, exchange, key string, mandatory bool, msg amqp.Publishing) error {
+	pub, err := conn.takePublisher()
+	if err != nil {
+		return err
+	}
+
+	confirmation, err := pub.ch.PublishWithDeferredConfirmWithContext(
+		ctx,
+		exchange,
+		key,
+		mandatory,
+		false, // immediate
+		msg,
+	)
+	if err != nil {
+		pub.ch.Close()
+		return err
+	}
+
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		// A late confirmation would be taken for the next publishing.
+		pub.ch.Close()
+		return err
+	}
+
+	// Returns are sent by the broker before the confirmation.
+	select {
+	case returned, ok := <-pub.returns:
+		if ok {
+			conn.releasePublisher(pub)
+			return fmt.Errorf("%w: %s %s", ErrMessageReturned, key, returned.ReplyText)
+		}
+	default:
+	}
+
+	conn.releasePublisher(pub)
+
+	if !acked {
+		return ErrMessageNacked
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Backends of Queue.
+const (
+	BackendRabbitMQ = "rabbitmq"
+	BackendNATS     = "nats"
+	BackendMemory   = "memory"
+)
+
+// Queue delivers repo requests from the API to dataloaders and domain events
+// from dataloaders to other services.
+type Queue interface {
+	PushRepoRequest(ctx context.Context, lane Lane, req *GithubRepoRequestMessage) error
+
+	// PublishEvent publishes the domain event to other services.
+	PublishEvent(ctx context.Context, event *Event) error
+
+	// Consume delivers requests of the lane one at a time until the context is
+	// done. The channel is closed if consuming stops.
+	Consume(ctx context.Context, lane Lane) (<-chan Delivery, error)
+
+	IsConnected() bool
+
+	// Connected returns a channel which is closed once the queue is connected.
+	Connected() <-chan struct{}
+
+	Close() error
+}
+
+// Delivery is a repo request taken from a lane. It is settled once by Ack,
+// Requeue, Retry, Delay or Park.
+type Delivery interface {
+	Lane() Lane
+	Body() []byte
+	MessageID() string
+
+	// Context returns ctx with the trace context of the request producer.
+	Context(ctx context.Context) context.Context
+
+	// Retries is the number of times the request was retried.
+	Retries() int
+
+	Ack() error
+
+	// Requeue returns the request to the lane at once.
+	Requeue() error
+
+	// Retry returns the request to the lane after the backoff of the next
+	// retry.
+	Retry(ctx context.Context) error
+
+	// Delay returns the request to the lane after the delay. It is not counted
+	// as a retry.
+	Delay(ctx context.Context, delay time.Duration) error
+
+	// Park moves the request to the parking lot for inspection.
+	Park(ctx context.Context, reason string) error
+}
+
+var ErrMemoryQueueNotShared = errors.New("memory queue is not shared between processes, run the versions binary instead")
+
+// NewQueue connects to the queue of the backend. The memory queue is rejected,
+// since the API and dataloaders run in separate processes.
+func NewQueue(backend, uri string) (Queue, error) {
+	switch backend {
+	case BackendRabbitMQ:
+		return NewAMQPConnection(uri)
+	case BackendNATS:
+		return NewNATSQueue(uri)
+	case BackendMemory:
+		return nil, ErrMemoryQueueNotShared
+	}
+
+	return nil, fmt.Errorf("unknown queue backend %q", backend)
+}
+
+var (
+	_ Queue = (*AMQPConnection)(nil)
+	_ Queue = (*NATSQueue)(nil)
+	_ Queue = (*MemoryQueue)(nil)
+)
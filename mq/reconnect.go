@@ -0,0 +1,128 @@
+package mq
+
+import (
+	"errors"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	minReconnectDelay = 1 * time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+var ErrDisconnected = errors.New("RabbitMQ connection is lost")
+
+// connect dials the broker and declares the topology. Returns the channel of
+// the connection closing.
+func (conn *AMQPConnection) connect() (chan *amqp.Error, error) {
+	amqpConn, err := amqp.Dial(conn.uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := declareTopology(amqpConn); err != nil {
+		amqpConn.Close()
+		return nil, err
+	}
+
+	closes := amqpConn.NotifyClose(make(chan *amqp.Error, 1))
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	if conn.closed {
+		amqpConn.Close()
+		return nil, amqp.ErrClosed
+	}
+
+	conn.conn = amqpConn
+	close(conn.connected)
+
+	return closes, nil
+}
+
+// reconnectOnClose connects again with backoff every time the connection is
+// lost, until it is closed by Close.
+func (conn *AMQPConnection) reconnectOnClose(closes chan *amqp.Error) {
+	for {
+		closeErr, lost := <-closes
+		if !lost {
+			return // Closed by Close
+		}
+
+		log.Error().Err(closeErr).Msg("RabbitMQ connection is lost, reconnecting")
+
+		conn.mu.Lock()
+		conn.connected = make(chan struct{})
+		conn.mu.Unlock()
+
+		delay := minReconnectDelay
+		for {
+			time.Sleep(delay)
+			if conn.isClosed() {
+				return
+			}
+
+			var err error
+			if closes, err = conn.connect(); err == nil {
+				break
+			} else if conn.isClosed() {
+				return
+			}
+
+			log.Error().Err(err).Msgf("RabbitMQ reconnection failed, retrying in %s", delay)
+
+			if delay *= 2; delay > maxReconnectDelay {
+				delay = maxReconnectDelay
+			}
+		}
+
+		log.Info().Msg("RabbitMQ connection is restored")
+	}
+}
+
+func (conn *AMQPConnection) isClosed() bool {
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+
+	return conn.closed
+}
+
+// IsConnected tells whether the connection is up.
+func (conn *AMQPConnection) IsConnected() bool {
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+
+	return conn.conn != nil && !conn.conn.IsClosed()
+}
+
+// Connected returns a channel which is closed once the connection is up.
+func (conn *AMQPConnection) Connected() <-chan struct{} {
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+
+	return conn.connected
+}
+
+// Channel opens a channel of the current connection.
+func (conn *AMQPConnection) Channel() (*amqp.Channel, error) {
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+
+	if conn.conn == nil || conn.conn.IsClosed() {
+		return nil, ErrDisconnected
+	}
+
+	return conn.conn.Channel()
+}
+
+func (conn *AMQPConnection) Close() error {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	conn.closed = true
+	return conn.conn.Close()
+}
@@ -0,0 +1,60 @@
+package mq
+
+import (
+	"context"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/lesnoi-kot/versions-backend/tracing"
+)
+
+// amqpHeaderCarrier carries trace context in AMQP headers.
+type amqpHeaderCarrier amqp.Table
+
+func (carrier amqpHeaderCarrier) Get(key string) string {
+	value, _ := carrier[key].(string)
+	return value
+}
+
+func (carrier amqpHeaderCarrier) Set(key, value string) {
+	carrier[key] = value
+}
+
+func (carrier amqpHeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(carrier))
+	for key := range carrier {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// startPublishSpan starts the producer span of a repo request.
+func startPublishSpan(ctx context.Context, lane Lane, req *GithubRepoRequestMessage) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(
+		ctx,
+		lane.QueueName()+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.destination.name", lane.QueueName()),
+			attribute.String("messaging.message.id", req.DeduplicationID),
+			attribute.String("github.repo", req.Owner+"/"+req.Repo),
+		),
+	)
+}
+
+// traceHeaders returns headers of the trace context of the delivery, so it is
+// kept when the request is published again.
+func traceHeaders(headers amqp.Table) amqp.Table {
+	traced := amqp.Table{}
+	for _, field := range otel.GetTextMapPropagator().Fields() {
+		if value, ok := headers[field]; ok {
+			traced[field] = value
+		}
+	}
+
+	return traced
+}
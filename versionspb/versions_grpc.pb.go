@@ -0,0 +1,287 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: versions/v1/versions.proto
+
+package versionspb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	VersionsService_ListSources_FullMethodName   = "/versions.v1.VersionsService/ListSources"
+	VersionsService_GetSource_FullMethodName     = "/versions.v1.VersionsService/GetSource"
+	VersionsService_ListReleases_FullMethodName  = "/versions.v1.VersionsService/ListReleases"
+	VersionsService_AddSource_FullMethodName     = "/versions.v1.VersionsService/AddSource"
+	VersionsService_WatchReleases_FullMethodName = "/versions.v1.VersionsService/WatchReleases"
+)
+
+// VersionsServiceClient is the client API for VersionsService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type VersionsServiceClient interface {
+	ListSources(ctx context.Context, in *ListSourcesRequest, opts ...grpc.CallOption) (*ListSourcesResponse, error)
+	GetSource(ctx context.Context, in *GetSourceRequest, opts ...grpc.CallOption) (*Source, error)
+	ListReleases(ctx context.Context, in *ListReleasesRequest, opts ...grpc.CallOption) (*ListReleasesResponse, error)
+	AddSource(ctx context.Context, in *AddSourceRequest, opts ...grpc.CallOption) (*Source, error)
+	// WatchReleases streams releases added after the call is made.
+	WatchReleases(ctx context.Context, in *WatchReleasesRequest, opts ...grpc.CallOption) (VersionsService_WatchReleasesClient, error)
+}
+
+type versionsServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewVersionsServiceClient(cc grpc.ClientConnInterface) VersionsServiceClient {
+	return &versionsServiceClient{cc}
+}
+
+func (c *versionsServiceClient) ListSources(ctx context.Context, in *ListSourcesRequest, opts ...grpc.CallOption) (*ListSourcesResponse, error) {
+	out := new(ListSourcesResponse)
+	err := c.cc.Invoke(ctx, VersionsService_ListSources_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *versionsServiceClient) GetSource(ctx context.Context, in *GetSourceRequest, opts ...grpc.CallOption) (*Source, error) {
+	out := new(Source)
+	err := c.cc.Invoke(ctx, VersionsService_GetSource_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *versionsServiceClient) ListReleases(ctx context.Context, in *ListReleasesRequest, opts ...grpc.CallOption) (*ListReleasesResponse, error) {
+	out := new(ListReleasesResponse)
+	err := c.cc.Invoke(ctx, VersionsService_ListReleases_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *versionsServiceClient) AddSource(ctx context.Context, in *AddSourceRequest, opts ...grpc.CallOption) (*Source, error) {
+	out := new(Source)
+	err := c.cc.Invoke(ctx, VersionsService_AddSource_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *versionsServiceClient) WatchReleases(ctx context.Context, in *WatchReleasesRequest, opts ...grpc.CallOption) (VersionsService_WatchReleasesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &VersionsService_ServiceDesc.Streams[0], VersionsService_WatchReleases_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &versionsServiceWatchReleasesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type VersionsService_WatchReleasesClient interface {
+	Recv() (*Release, error)
+	grpc.ClientStream
+}
+
+type versionsServiceWatchReleasesClient struct {
+	grpc.ClientStream
+}
+
+func (x *versionsServiceWatchReleasesClient) Recv() (*Release, error) {
+	m := new(Release)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// VersionsServiceServer is the server API for VersionsService service.
+// All implementations must embed UnimplementedVersionsServiceServer
+// for forward compatibility
+type VersionsServiceServer interface {
+	ListSources(context.Context, *ListSourcesRequest) (*ListSourcesResponse, error)
+	GetSource(context.Context, *GetSourceRequest) (*Source, error)
+	ListReleases(context.Context, *ListReleasesRequest) (*ListReleasesResponse, error)
+	AddSource(context.Context, *AddSourceRequest) (*Source, error)
+	// WatchReleases streams releases added after the call is made.
+	WatchReleases(*WatchReleasesRequest, VersionsService_WatchReleasesServer) error
+	mustEmbedUnimplementedVersionsServiceServer()
+}
+
+// UnimplementedVersionsServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedVersionsServiceServer struct {
+}
+
+func (UnimplementedVersionsServiceServer) ListSources(context.Context, *ListSourcesRequest) (*ListSourcesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSources not implemented")
+}
+func (UnimplementedVersionsServiceServer) GetSource(context.Context, *GetSourceRequest) (*Source, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSource not implemented")
+}
+func (UnimplementedVersionsServiceServer) ListReleases(context.Context, *ListReleasesRequest) (*ListReleasesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListReleases not implemented")
+}
+func (UnimplementedVersionsServiceServer) AddSource(context.Context, *AddSourceRequest) (*Source, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddSource not implemented")
+}
+func (UnimplementedVersionsServiceServer) WatchReleases(*WatchReleasesRequest, VersionsService_WatchReleasesServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchReleases not implemented")
+}
+func (UnimplementedVersionsServiceServer) mustEmbedUnimplementedVersionsServiceServer() {}
+
+// UnsafeVersionsServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to VersionsServiceServer will
+// result in compilation errors.
+type UnsafeVersionsServiceServer interface {
+	mustEmbedUnimplementedVersionsServiceServer()
+}
+
+func RegisterVersionsServiceServer(s grpc.ServiceRegistrar, srv VersionsServiceServer) {
+	s.RegisterService(&VersionsService_ServiceDesc, srv)
+}
+
+func _VersionsService_ListSources_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSourcesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VersionsServiceServer).ListSources(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VersionsService_ListSources_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VersionsServiceServer).ListSources(ctx, req.(*ListSourcesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VersionsService_GetSource_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSourceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VersionsServiceServer).GetSource(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VersionsService_GetSource_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VersionsServiceServer).GetSource(ctx, req.(*GetSourceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VersionsService_ListReleases_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListReleasesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VersionsServiceServer).ListReleases(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VersionsService_ListReleases_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VersionsServiceServer).ListReleases(ctx, req.(*ListReleasesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VersionsService_AddSource_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddSourceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VersionsServiceServer).AddSource(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VersionsService_AddSource_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VersionsServiceServer).AddSource(ctx, req.(*AddSourceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VersionsService_WatchReleases_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchReleasesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(VersionsServiceServer).WatchReleases(m, &versionsServiceWatchReleasesServer{stream})
+}
+
+type VersionsService_WatchReleasesServer interface {
+	Send(*Release) error
+	grpc.ServerStream
+}
+
+type versionsServiceWatchReleasesServer struct {
+	grpc.ServerStream
+}
+
+func (x *versionsServiceWatchReleasesServer) Send(m *Release) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// VersionsService_ServiceDesc is the grpc.ServiceDesc for VersionsService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var VersionsService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "versions.v1.VersionsService",
+	HandlerType: (*VersionsServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListSources",
+			Handler:    _VersionsService_ListSources_Handler,
+		},
+		{
+			MethodName: "GetSource",
+			Handler:    _VersionsService_GetSource_Handler,
+		},
+		{
+			MethodName: "ListReleases",
+			Handler:    _VersionsService_ListReleases_Handler,
+		},
+		{
+			MethodName: "AddSource",
+			Handler:    _VersionsService_AddSource_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchReleases",
+			Handler:       _VersionsService_WatchReleases_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "versions/v1/versions.proto",
+}